@@ -76,3 +76,18 @@ func CreateDefaultConfig() (err error) {
 	}
 	return
 }
+
+// GetStateDir returns dxhd's directory in $XDG_STATE_HOME, ~/.local/state/dxhd by default
+func GetStateDir() (directory string, err error) {
+	directory = os.Getenv("XDG_STATE_HOME")
+	if directory == "" {
+		directory, err = os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		directory = filepath.Join(directory, ".local", "state")
+	}
+
+	directory = filepath.Join(directory, "dxhd")
+	return
+}
@@ -0,0 +1,168 @@
+// Package daemon runs dxhd in the background
+//
+// Go can not fork without executing, so the daemon is dxhd executed again in a new session, marked by an environment
+// variable. It reports over a pipe once its bindings are registered, or why it failed, to the process which started it.
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Env is set in the environment of the daemon
+const Env = "DXHD_DAEMON"
+
+// Timeout is how long Start waits for the daemon to report
+var Timeout = time.Second * 10
+
+// ErrNotReady is returned by Start when the daemon is running but did not report in time
+var ErrNotReady = errors.New("the daemon is not ready yet")
+
+var (
+	// pipe is the write end of the readiness pipe, nil once reported
+	pipe *os.File
+	mu   sync.Mutex
+)
+
+// Detach reports whether this process is a daemon started by Start, in which case it removes the marker from
+// the environment, so the commands it runs don't inherit it
+func Detach() bool {
+	if os.Getenv(Env) != "1" {
+		return false
+	}
+	_ = os.Unsetenv(Env)
+
+	// the readiness pipe is the first extra file, it must not leak into the commands
+	syscall.CloseOnExec(3)
+	pipe = os.NewFile(3, "readiness")
+	return true
+}
+
+// report writes a status line to the readiness pipe and closes it, only the first report is delivered
+func report(status, msg string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if pipe == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(pipe, "%s %s\n", status, strings.ReplaceAll(msg, "\n", " "))
+	_ = pipe.Close()
+	pipe = nil
+}
+
+// Ready tells the starting process the daemon is running, msg describes its state
+func Ready(msg string) {
+	report("ready", msg)
+}
+
+// Fail tells the starting process the daemon failed
+func Fail(err error) {
+	report("error", err.Error())
+}
+
+// Hook is a logrus hook reporting fatal log entries as failures
+type Hook struct{}
+
+// Levels implements logrus.Hook
+func (Hook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.FatalLevel, logrus.PanicLevel}
+}
+
+// Fire implements logrus.Hook
+func (Hook) Fire(entry *logrus.Entry) error {
+	msg := entry.Message
+	for key, value := range entry.Data {
+		msg += fmt.Sprintf(" %s=%v", key, value)
+	}
+	Fail(errors.New(msg))
+	return nil
+}
+
+// Start executes this program again with the same arguments as a daemon, feeding it stdin if it's not nil and
+// appending its output to logFile, or dropping it if logFile is empty.
+// It waits for the daemon to report, and returns its pid and what it reported.
+func Start(stdin []byte, logFile string) (pid int, msg string, err error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+
+	output, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if logFile != "" {
+		output, err = os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	}
+	if err != nil {
+		_ = w.Close()
+		return
+	}
+	defer output.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), Env+"=1")
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	} else if cmd.Stdin, err = os.Open(os.DevNull); err != nil {
+		_ = w.Close()
+		return
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.ExtraFiles = []*os.File{w}
+	// a new session detaches the daemon from the terminal
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		return
+	}
+	pid = cmd.Process.Pid
+
+	// the daemon is never waited for, it outlives this process
+	defer func() {
+		_ = cmd.Process.Release()
+	}()
+
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(r).ReadString('\n')
+		lines <- line
+	}()
+
+	select {
+	case line := <-lines:
+		if line == "" {
+			err = errors.New("the daemon exited before it was ready")
+			return
+		}
+		status := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 2)
+		if len(status) == 2 {
+			msg = status[1]
+		}
+		if status[0] != "ready" {
+			err = errors.New(msg)
+			msg = ""
+		}
+	case <-time.After(Timeout):
+		err = ErrNotReady
+	}
+
+	return
+}
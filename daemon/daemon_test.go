@@ -0,0 +1,68 @@
+package daemon_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/daemon"
+)
+
+// the test binary is what Start executes again, DXHD_TEST_DAEMON tells it how to behave as the daemon
+func TestMain(m *testing.M) {
+	if daemon.Detach() {
+		stdin, _ := ioutil.ReadAll(os.Stdin)
+		switch os.Getenv("DXHD_TEST_DAEMON") {
+		case "ready":
+			os.Stdout.WriteString("daemon output\n")
+			daemon.Ready("read " + string(stdin))
+		case "fail":
+			daemon.Fail(errors.New("can not grab"))
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestStartReady(t *testing.T) {
+	os.Setenv("DXHD_TEST_DAEMON", "ready")
+	defer os.Unsetenv("DXHD_TEST_DAEMON")
+
+	log := filepath.Join(t.TempDir(), "daemon.log")
+	pid, msg, err := daemon.Start([]byte("config"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid == 0 || msg != "read config" {
+		t.Fatalf("unexpected report %d, %q", pid, msg)
+	}
+
+	output, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "daemon output") {
+		t.Fatalf("unexpected output %q", output)
+	}
+}
+
+func TestStartFailed(t *testing.T) {
+	os.Setenv("DXHD_TEST_DAEMON", "fail")
+	defer os.Unsetenv("DXHD_TEST_DAEMON")
+
+	if _, _, err := daemon.Start(nil, ""); err == nil || err.Error() != "can not grab" {
+		t.Fatalf("expected the failure to be reported, got %v", err)
+	}
+}
+
+func TestStartExited(t *testing.T) {
+	os.Setenv("DXHD_TEST_DAEMON", "exit")
+	defer os.Unsetenv("DXHD_TEST_DAEMON")
+
+	if _, _, err := daemon.Start(nil, ""); err == nil {
+		t.Fatal("expected a daemon exiting without a report to fail")
+	}
+}
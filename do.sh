@@ -106,7 +106,7 @@ check_ensuredeps() {
 
 check_code() {
 	misspell .
-	go vet .
+	go vet ./...
 	golint .
 	staticcheck .
 	ineffassign .
@@ -0,0 +1,171 @@
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// Options describe the config the bindings are exported from, for the formats of other hotkey daemons
+type Options struct {
+	Shell   string
+	Globals string
+	// Scripts is the directory commands other hotkey daemons can not run as they are are written to, as scripts
+	Scripts string
+}
+
+// daemon describes the config syntax of another hotkey daemon
+type daemon struct {
+	// modifiers are the names of xgb's modifiers, the ones missing are named the same
+	modifiers map[string]string
+	// binding returns the binding of keys, the last one being the key or the button
+	binding func(keys []string, release, button bool) string
+	// entry returns a binding and its command in the config
+	entry func(binding, command string) string
+	// inline reports whether a command can be written into the config as it is
+	inline func(command string) bool
+}
+
+var daemons = map[string]daemon{
+	"sxhkd": {
+		modifiers: map[string]string{"mod4": "super", "mod1": "alt", "control": "ctrl"},
+		binding: func(keys []string, release, button bool) string {
+			last := len(keys) - 1
+			if button {
+				keys[last] = "button" + keys[last]
+			}
+			if release {
+				keys[last] = "@" + keys[last]
+			}
+			return strings.Join(keys, " + ")
+		},
+		entry: func(binding, command string) string {
+			return binding + "\n\t" + command + "\n"
+		},
+		// sxhkd expands braces in commands too
+		inline: func(command string) bool {
+			return !strings.ContainsAny(command, "{}")
+		},
+	},
+	"i3": {
+		modifiers: map[string]string{"mod4": "Mod4", "mod1": "Mod1", "control": "Ctrl", "shift": "Shift", "lock": "Lock",
+			"mod2": "Mod2", "mod3": "Mod3", "mod5": "Mod5"},
+		binding: func(keys []string, release, button bool) string {
+			last := len(keys) - 1
+			flags := ""
+			if release {
+				flags += "--release "
+			}
+			if button {
+				keys[last] = "button" + keys[last]
+				flags += "--whole-window "
+			}
+			return "bindsym " + flags + strings.Join(keys, "+")
+		},
+		entry: func(binding, command string) string {
+			return fmt.Sprintf("%s exec --no-startup-id \"%s\"\n", binding, strings.ReplaceAll(command, `"`, `\"`))
+		},
+		inline: func(command string) bool {
+			return true
+		},
+	},
+	"xbindkeys": {
+		modifiers: map[string]string{"mod4": "Mod4", "mod1": "Mod1", "control": "Control", "shift": "Shift", "lock": "Lock",
+			"mod2": "Mod2", "mod3": "Mod3", "mod5": "Mod5"},
+		binding: func(keys []string, release, button bool) string {
+			last := len(keys) - 1
+			if button {
+				keys[last] = "b:" + keys[last]
+			}
+			if release {
+				keys = append([]string{"Release"}, keys...)
+			}
+			return strings.Join(keys, " + ")
+		},
+		entry: func(binding, command string) string {
+			return fmt.Sprintf("\"%s\"\n    %s\n", command, binding)
+		},
+		inline: func(command string) bool {
+			return !strings.Contains(command, `"`)
+		},
+	},
+}
+
+// shells are the shells whose commands other hotkey daemons can run, as they run commands with sh -c
+var shells = map[string]bool{"sh": true, "dash": true, "bash": true}
+
+// writeDaemon exports the bindings to the config of another hotkey daemon, writing the commands it can not run as they
+// are into scripts
+func writeDaemon(b *strings.Builder, to string, d daemon, data []parser.FileData, opts Options) (err error) {
+	fmt.Fprintf(b, "# %s config exported from dxhd\n", to)
+
+	scripts := scriptNames{}
+	for i := range data {
+		fd := &data[i]
+		b.WriteString("\n")
+		if fd.Description != "" {
+			b.WriteString("# " + fd.Description + "\n")
+		}
+
+		switch {
+		case fd.Device != "":
+			fmt.Fprintf(b, "# %s can not be exported, %s can not tell devices apart\n", label(fd), to)
+			continue
+		case fd.EvtType == parser.EvtButtonDrag || fd.EvtType == parser.EvtHotCorner:
+			fmt.Fprintf(b, "# %s can not be exported, %s has no %s events\n", label(fd), to, fd.EvtType)
+			continue
+		}
+
+		keys := strings.Split(fd.Binding.String(), "-")
+		for k, key := range keys[:len(keys)-1] {
+			if name, ok := d.modifiers[strings.ToLower(key)]; ok {
+				keys[k] = name
+			}
+		}
+		release := fd.EvtType == parser.EvtKeyRelease || fd.EvtType == parser.EvtButtonRelease
+		button := fd.EvtType == parser.EvtButtonPress || fd.EvtType == parser.EvtButtonRelease
+
+		command := strings.TrimSpace(fd.Command.String())
+		if strings.Contains(command, "\n") || opts.Globals != "" || !shells[filepath.Base(opts.Shell)] || !d.inline(command) {
+			if command, err = scripts.write(opts, fd.OriginalBinding, command); err != nil {
+				return
+			}
+		}
+
+		b.WriteString(d.entry(d.binding(keys, release, button), command))
+	}
+	return
+}
+
+// scriptNames hands out a distinct script name for each binding
+type scriptNames map[string]bool
+
+// write writes a command into a script and returns the path to it
+func (names scriptNames) write(opts Options, binding, command string) (path string, err error) {
+	if opts.Scripts == "" {
+		return "", fmt.Errorf("%s has to be written into a script, but no directory was given for scripts", binding)
+	}
+	dir, err := filepath.Abs(opts.Scripts)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	name := strings.Join(strings.FieldsFunc(strings.ReplaceAll(binding, "@", "release-"), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+	}), "-")
+	for n, base := 2, name; names[name] || name == ""; n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	names[name] = true
+
+	path = filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(fmt.Sprintf("#!%s\n%s%s\n", opts.Shell, opts.Globals, command)), 0755)
+	return
+}
@@ -0,0 +1,67 @@
+// Package export prints the bindings of a config as cheat sheets and menus
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// Formats are the formats Write can export bindings to
+var Formats = []string{"markdown", "html", "rofi", "sxhkd", "i3", "xbindkeys"}
+
+// Title is the title of the cheat sheets
+const Title = "dxhd keybindings"
+
+func label(d *parser.FileData) string {
+	return parser.Label(d.OriginalBinding, d.Device)
+}
+
+func summary(d *parser.FileData) string {
+	return parser.Summary(d.Description, d.Command.String())
+}
+
+// Write exports the bindings to w in given format
+func Write(w io.Writer, to string, data []parser.FileData, opts Options) (err error) {
+	var b strings.Builder
+
+	switch to {
+	case "", "markdown":
+		fmt.Fprintf(&b, "# %s\n\n| Binding | Description |\n| --- | --- |\n", Title)
+		escape := strings.NewReplacer("|", `\|`, "`", "\\`")
+		for i := range data {
+			fmt.Fprintf(&b, "| `%s` | %s |\n", label(&data[i]), escape.Replace(summary(&data[i])))
+		}
+	case "html":
+		fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n<table>\n", Title, Title)
+		b.WriteString("<tr><th>Binding</th><th>Description</th></tr>\n")
+		for i := range data {
+			var keys []string
+			for _, key := range strings.Split(data[i].OriginalBinding, "+") {
+				keys = append(keys, "<kbd>"+html.EscapeString(key)+"</kbd>")
+			}
+			binding := strings.Join(keys, " + ")
+			if data[i].Device != "" {
+				binding += " on " + html.EscapeString(data[i].Device)
+			}
+			fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td></tr>\n", binding, html.EscapeString(summary(&data[i])))
+		}
+		b.WriteString("</table>\n</body>\n</html>\n")
+	case "rofi", "dmenu":
+		for _, line := range parser.Lines(data) {
+			b.WriteString(line + "\n")
+		}
+	case "sxhkd", "i3", "xbindkeys":
+		if err = writeDaemon(&b, to, daemons[to], data, opts); err != nil {
+			return
+		}
+	default:
+		return fmt.Errorf("can not export to %s, use one of %s", to, strings.Join(Formats, ", "))
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return
+}
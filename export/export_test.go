@@ -0,0 +1,137 @@
+package export_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/export"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+const config = `#!/bin/sh
+## restart i3
+# super + shift + r
+i3-msg restart
+
+## switch to workspace {1-2}
+# super + {1-2}
+i3-msg workspace {1-2}
+
+# [device="Pad"] mouse1
+printf "a|b"
+echo <done>
+`
+
+func parse(t *testing.T) (data []parser.FileData) {
+	t.Helper()
+	if _, _, err := parser.Parse([]byte(config), &data); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestWrite(t *testing.T) {
+	data := parse(t)
+
+	tests := map[string][]string{
+		"markdown": {
+			"| `super + shift + r` | restart i3 |\n",
+			"| `super + 2` | switch to workspace 2 |\n",
+			"| `mouse1 [Pad]` | printf \"a\\|b\" ... |\n",
+		},
+		"html": {
+			"<tr><td><kbd>super</kbd> + <kbd>1</kbd></td><td>switch to workspace 1</td></tr>\n",
+			"<tr><td><kbd>mouse1</kbd> on Pad</td><td>printf &#34;a|b&#34; ...</td></tr>\n",
+		},
+		"rofi": {
+			"super + shift + r  restart i3\n",
+			"mouse1 [Pad]       printf \"a|b\" ...\n",
+		},
+	}
+
+	for to, lines := range tests {
+		var b strings.Builder
+		if err := export.Write(&b, to, data, export.Options{}); err != nil {
+			t.Fatalf("%s: %v", to, err)
+		}
+		for _, line := range lines {
+			if !strings.Contains(b.String(), line) {
+				t.Errorf("%s: expected %q in\n%s", to, line, b.String())
+			}
+		}
+	}
+
+	var b strings.Builder
+	if err := export.Write(&b, "pdf", data, export.Options{}); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestWriteDaemons(t *testing.T) {
+	var data []parser.FileData
+	shell, globals, err := parser.Parse([]byte(`#!/bin/sh
+## switch to workspace {1-2}
+# ctrl + alt + {1-2}
+i3-msg "workspace {1-2}"
+
+# super + @Return
+echo "a;b"
+
+# super + @mouse1
+echo one
+echo two
+
+# super + mouse1drag
+echo drag
+`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	opts := export.Options{Shell: shell, Globals: globals, Scripts: dir}
+	script := dir + "/super-release-mouse1"
+
+	tests := map[string][]string{
+		"sxhkd": {
+			"# switch to workspace 2\nctrl + alt + 2\n\ti3-msg \"workspace 2\"\n",
+			"super + @Return\n\techo \"a;b\"\n",
+			"super + @button1\n\t" + script + "\n",
+			"# super + mouse1drag can not be exported",
+		},
+		"i3": {
+			"bindsym Ctrl+Mod1+1 exec --no-startup-id \"i3-msg \\\"workspace 1\\\"\"\n",
+			"bindsym --release Mod4+Return exec --no-startup-id \"echo \\\"a;b\\\"\"\n",
+			"bindsym --release --whole-window Mod4+button1 exec --no-startup-id \"" + script + "\"\n",
+		},
+		"xbindkeys": {
+			"\"" + dir + "/ctrl-alt-1\"\n    Control + Mod1 + 1\n",
+			"\"" + script + "\"\n    Release + Mod4 + b:1\n",
+		},
+	}
+
+	for to, entries := range tests {
+		var b strings.Builder
+		if err := export.Write(&b, to, data, opts); err != nil {
+			t.Fatalf("%s: %v", to, err)
+		}
+		for _, entry := range entries {
+			if !strings.Contains(b.String(), entry) {
+				t.Errorf("%s: expected %q in\n%s", to, entry, b.String())
+			}
+		}
+	}
+
+	content, err := ioutil.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "#!/bin/sh\necho one\necho two\n" {
+		t.Errorf("unexpected script %q", content)
+	}
+
+	if err := export.Write(ioutil.Discard, "i3", data, export.Options{Shell: shell}); err == nil {
+		t.Error("expected an error when a script is needed but no directory was given")
+	}
+}
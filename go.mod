@@ -3,7 +3,7 @@ module github.com/dakyskye/dxhd
 go 1.15
 
 require (
-	github.com/BurntSushi/xgb v0.0.0-20200324125942-20f126ea2843 // indirect
+	github.com/BurntSushi/xgb v0.0.0-20200324125942-20f126ea2843
 	github.com/BurntSushi/xgbutil v0.0.0-20190907113008-ad855c713046
 	github.com/sirupsen/logrus v1.6.0
 	golang.org/x/sys v0.0.0-20200831180312-196b9ba8737a // indirect
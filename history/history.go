@@ -0,0 +1,185 @@
+// Package history keeps the output of executed commands in rotating log files, one per binding
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxSize is the size a log file can grow to before it's rotated, a single rotated file is kept
+var MaxSize int64 = 256 * 1024
+
+// MaxOutput is how many bytes of stderr are kept per execution
+const MaxOutput = 4096
+
+// Entry describes a single execution of a binding's command
+type Entry struct {
+	Binding  string        `json:"binding"`
+	Command  string        `json:"command"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exit_code"`
+	Stderr   string        `json:"stderr,omitempty"`
+}
+
+// Log writes entries into a directory
+type Log struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns a log writing into given directory, creating it if needed, the output of commands is only readable
+// by the user
+func Open(dir string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// the directory may have been created by an older dxhd
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Log{dir: dir}, nil
+}
+
+// fileName returns the name of the log file of a binding, @ is kept so released keys have their own file
+func fileName(binding string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '@':
+			return r
+		case r == '+':
+			return '-'
+		}
+		return -1
+	}, strings.ReplaceAll(binding, " ", ""))
+	if name == "" {
+		name = "binding"
+	}
+	return name + ".log"
+}
+
+// Write appends an entry to its binding's log file, rotating the file once it gets too big
+func (l *Log) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	path := filepath.Join(l.dir, fileName(e.Binding))
+	if stat, err := os.Stat(path); err == nil && stat.Size()+int64(len(line)) > MaxSize {
+		if err = os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the entries logged in a directory, oldest first, only those of given binding if it's not empty
+func Read(dir, binding string) (entries []Entry, err error) {
+	pattern := "*.log*"
+	if binding != "" {
+		pattern = fileName(binding) + "*"
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return
+	}
+
+	for _, path := range paths {
+		var read []Entry
+		read, err = readFile(path)
+		if err != nil {
+			return
+		}
+		entries = append(entries, read...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Start.Before(entries[j].Start)
+	})
+	return
+}
+
+func readFile(path string) (entries []Entry, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), int(MaxSize))
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			err = fmt.Errorf("%s:%d: %w", path, line, err)
+			return
+		}
+		entries = append(entries, e)
+	}
+	err = scanner.Err()
+	return
+}
+
+// Print writes entries in a human readable form
+func Print(w io.Writer, entries []Entry) {
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s %s exited with %d after %s\n", e.Start.Format("2006-01-02 15:04:05"), e.Binding, e.ExitCode, e.Duration.Round(time.Millisecond))
+		printOutput(w, "stderr", e.Stderr)
+	}
+}
+
+func printOutput(w io.Writer, name, output string) {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fmt.Fprintf(w, "  %s | %s\n", name, line)
+	}
+}
+
+// Buffer is a writer keeping at most MaxOutput bytes, the last ones written
+type Buffer struct {
+	buf []byte
+	mu  sync.Mutex
+}
+
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > MaxOutput {
+		b.buf = b.buf[len(b.buf)-MaxOutput:]
+	}
+	return len(p), nil
+}
+
+func (b *Buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return string(b.buf)
+}
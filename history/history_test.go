@@ -0,0 +1,133 @@
+package history_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dakyskye/dxhd/history"
+)
+
+func TestLogWritesAndReads(t *testing.T) {
+	dir := t.TempDir()
+	log, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	entries := []history.Entry{
+		{Binding: "super+a", Command: "echo a >&2", Start: start, Stderr: "a\n"},
+		{Binding: "super+b", Command: "false", Start: start.Add(time.Second), ExitCode: 1, Stderr: "oops\n"},
+		{Binding: "super+a", Command: "echo a >&2", Start: start.Add(2 * time.Second), Stderr: "a\n"},
+	}
+	for _, e := range entries {
+		if err = log.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := history.Read(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[1].Binding != "super+b" {
+		t.Fatalf("expected the entries in order, got %+v", all)
+	}
+
+	only, err := history.Read(dir, "super + a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(only) != 2 {
+		t.Fatalf("expected 2 entries of super+a, got %d", len(only))
+	}
+
+	out := new(bytes.Buffer)
+	history.Print(out, all)
+	if !strings.Contains(out.String(), "super+b exited with 1") || !strings.Contains(out.String(), "stderr | oops") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestLogKeepsReleasesApart(t *testing.T) {
+	dir := t.TempDir()
+	log, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, binding := range []string{"super+a", "super+@a"} {
+		if err = log.Write(history.Entry{Binding: binding}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, binding := range []string{"super + a", "super + @a"} {
+		entries, err := history.Read(dir, binding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected 1 entry of %s, got %d", binding, len(entries))
+		}
+	}
+}
+
+func TestLogIsPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dxhd")
+	log, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = log.Write(history.Entry{Binding: "super+a", Stderr: "secret\n"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]os.FileMode{dir: 0700, filepath.Join(dir, "super-a.log"): 0600} {
+		stat, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := stat.Mode().Perm(); got != want {
+			t.Errorf("expected %s to have mode %o, got %o", path, want, got)
+		}
+	}
+}
+
+func TestLogRotates(t *testing.T) {
+	defer func(size int64) { history.MaxSize = size }(history.MaxSize)
+	history.MaxSize = 512
+
+	dir := t.TempDir()
+	log, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err = log.Write(history.Entry{Binding: "super+a", Stderr: strings.Repeat("x", 64)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := history.Read(dir, "super+a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) == 0 || len(entries) >= 20 {
+		t.Fatalf("expected old entries to be rotated away, got %d", len(entries))
+	}
+}
+
+func TestBufferKeepsTheTail(t *testing.T) {
+	b := new(history.Buffer)
+	_, _ = b.Write([]byte(strings.Repeat("a", history.MaxOutput)))
+	_, _ = b.Write([]byte("end"))
+
+	if got := b.String(); len(got) != history.MaxOutput || !strings.HasSuffix(got, "end") {
+		t.Fatalf("expected the last %d bytes, got %d ending with %q", history.MaxOutput, len(got), got[len(got)-3:])
+	}
+}
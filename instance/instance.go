@@ -0,0 +1,163 @@
+// Package instance tells named dxhd instances apart, each one holds a lock and a PID file in the runtime directory
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Default is the name of an instance started without --name
+const Default = "dxhd"
+
+// ErrNotRunning is returned when signalling an instance which is not running
+var ErrNotRunning = errors.New("the instance is not running")
+
+// RunningError is returned when acquiring an instance which is already running
+type RunningError struct {
+	Name string
+	PID  int
+}
+
+func (e RunningError) Error() string {
+	return fmt.Sprintf("instance %s is already running with pid %d", e.Name, e.PID)
+}
+
+// Instance is an acquired instance, its lock is held until it's released or the process exits
+type Instance struct {
+	Name string
+	dir  string
+	lock *os.File
+}
+
+// Dir returns the directory of the lock and PID files, $XDG_RUNTIME_DIR/dxhd or a per user directory in /tmp
+func Dir() string {
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		return filepath.Join(runtime, "dxhd")
+	}
+	return filepath.Join(os.TempDir(), "dxhd-"+strconv.Itoa(os.Getuid()))
+}
+
+// ValidateName makes sure a name can be used as a file name
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf("%q is not a valid instance name", name)
+	}
+	return nil
+}
+
+func lockPath(dir, name string) string {
+	return filepath.Join(dir, name+".lock")
+}
+
+func pidPath(dir, name string) string {
+	return filepath.Join(dir, name+".pid")
+}
+
+// Acquire locks an instance of given name and writes its PID file, it fails with RunningError if it's already running
+func Acquire(name string) (i *Instance, err error) {
+	if err = ValidateName(name); err != nil {
+		return
+	}
+
+	dir := Dir()
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	lock, err := os.OpenFile(lockPath(dir, name), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = lock.Close()
+		if err == syscall.EWOULDBLOCK {
+			pid, _ := readPID(dir, name)
+			err = RunningError{Name: name, PID: pid}
+		}
+		return
+	}
+
+	err = ioutil.WriteFile(pidPath(dir, name), []byte(strconv.Itoa(os.Getpid())+"\n"), 0600)
+	if err != nil {
+		_ = lock.Close()
+		return
+	}
+
+	return &Instance{Name: name, dir: dir, lock: lock}, nil
+}
+
+// Release removes the PID file and unlocks the instance
+func (i *Instance) Release() {
+	_ = os.Remove(pidPath(i.dir, i.Name))
+	_ = i.lock.Close()
+}
+
+func readPID(dir, name string) (int, error) {
+	b, err := ioutil.ReadFile(pidPath(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// running reports whether the lock of an instance is held
+func running(dir, name string) bool {
+	lock, err := os.Open(lockPath(dir, name))
+	if err != nil {
+		return false
+	}
+	defer lock.Close()
+
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+	_ = syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	return false
+}
+
+// PID returns the PID of a running instance
+func PID(name string) (int, error) {
+	if err := ValidateName(name); err != nil {
+		return 0, err
+	}
+
+	dir := Dir()
+	// a PID file left behind by a crashed instance may name an unrelated process by now
+	if !running(dir, name) {
+		return 0, ErrNotRunning
+	}
+	return readPID(dir, name)
+}
+
+// Signal sends a signal to a running instance
+func Signal(name string, sig syscall.Signal) error {
+	pid, err := PID(name)
+	if err != nil {
+		return err
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// List returns the names of the running instances
+func List() (names []string, err error) {
+	dir := Dir()
+	locks, err := filepath.Glob(filepath.Join(dir, "*.lock"))
+	if err != nil {
+		return
+	}
+
+	for _, lock := range locks {
+		name := strings.TrimSuffix(filepath.Base(lock), ".lock")
+		if running(dir, name) {
+			names = append(names, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package instance_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/dakyskye/dxhd/instance"
+)
+
+func TestAcquire(t *testing.T) {
+	os.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	defer os.Unsetenv("XDG_RUNTIME_DIR")
+
+	work, err := instance.Acquire("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = instance.Acquire("work"); err == nil {
+		t.Fatal("expected acquiring a running instance to fail")
+	} else if running, ok := err.(instance.RunningError); !ok || running.PID != os.Getpid() {
+		t.Fatalf("expected a RunningError naming pid %d, got %v", os.Getpid(), err)
+	}
+
+	games, err := instance.Acquire("games")
+	if err != nil {
+		t.Fatalf("expected instances of other names to start, got %v", err)
+	}
+	defer games.Release()
+
+	if pid, err := instance.PID("work"); err != nil || pid != os.Getpid() {
+		t.Fatalf("expected pid %d, got %d, %v", os.Getpid(), pid, err)
+	}
+	if names, err := instance.List(); err != nil || len(names) != 2 {
+		t.Fatalf("expected 2 running instances, got %v, %v", names, err)
+	}
+
+	work.Release()
+
+	if _, err = instance.PID("work"); err != instance.ErrNotRunning {
+		t.Fatalf("expected %v once released, got %v", instance.ErrNotRunning, err)
+	}
+	again, err := instance.Acquire("work")
+	if err != nil {
+		t.Fatalf("expected a released instance to start again, got %v", err)
+	}
+	again.Release()
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"", "..", "a/b"} {
+		if instance.ValidateName(name) == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+//go:build integration
+// +build integration
+
+// Package integration runs dxhd against a real X server, started with Xvfb,
+// injecting input through the XTEST extension
+package integration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgb/xtest"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+)
+
+// dxhd is the path to the dxhd binary built by TestMain
+var dxhd string
+
+func TestMain(m *testing.M) {
+	if _, err := exec.LookPath("Xvfb"); err != nil {
+		fmt.Println("skipping integration tests, Xvfb is not installed")
+		os.Exit(0)
+	}
+
+	dir, err := ioutil.TempDir("", "dxhd-integration")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	dxhd = filepath.Join(dir, "dxhd")
+	build := exec.Command("go", "build", "-o", dxhd, "..")
+	build.Stdout, build.Stderr = os.Stdout, os.Stderr
+	if err = build.Run(); err != nil {
+		fmt.Println("can not build dxhd:", err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// session is an Xvfb server with dxhd running on it
+type session struct {
+	t       *testing.T
+	display string
+	dir     string
+	config  string
+	X       *xgbutil.XUtil
+	xvfb    *exec.Cmd
+	dxhd    *exec.Cmd
+}
+
+// newSession starts Xvfb and dxhd with given fixture config from testdata,
+// $DIR in the config is replaced with a temporary directory commands can write to
+func newSession(t *testing.T, fixture string) *session {
+	t.Helper()
+
+	s := &session{t: t}
+
+	var err error
+	s.dir, err = ioutil.TempDir("", "dxhd-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.startXvfb()
+	s.writeConfig(fixture)
+	s.startDxhd()
+	s.waitReady("F12")
+
+	return s
+}
+
+// startXvfb starts Xvfb on the first free display and connects to it
+func (s *session) startXvfb() {
+	s.t.Helper()
+
+	for n := 99; n < 199; n++ {
+		if _, err := os.Stat(fmt.Sprintf("/tmp/.X11-unix/X%d", n)); err == nil {
+			continue
+		}
+		s.display = fmt.Sprintf(":%d", n)
+		break
+	}
+	if s.display == "" {
+		s.t.Fatal("no free X display was found")
+	}
+
+	s.xvfb = exec.Command("Xvfb", s.display, "-screen", "0", "1024x768x24", "-nolisten", "tcp")
+	if err := s.xvfb.Start(); err != nil {
+		s.t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second * 10)
+	for {
+		X, err := xgbutil.NewConnDisplay(s.display)
+		if err == nil {
+			s.X = X
+			break
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("Xvfb did not come up on %s: %v", s.display, err)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if err := xtest.Init(s.X.Conn()); err != nil {
+		s.t.Fatalf("the XTEST extension is not available: %v", err)
+	}
+	keybind.Initialize(s.X)
+}
+
+// writeConfig copies a fixture into the session directory
+func (s *session) writeConfig(fixture string) {
+	s.t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	s.config = filepath.Join(s.dir, "dxhd.sh")
+	err = ioutil.WriteFile(s.config, []byte(strings.ReplaceAll(string(data), "$DIR", s.dir)), 0644)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *session) startDxhd() {
+	s.t.Helper()
+
+	s.dxhd = exec.Command(dxhd, "-c", s.config, "-x", s.display)
+	// the lock, the PID file and the history of each session are its own, and not the ones of a dxhd running
+	// on the developer's desktop
+	s.dxhd.Env = append(os.Environ(), "XDG_RUNTIME_DIR="+s.dir, "XDG_STATE_HOME="+s.dir)
+	s.dxhd.Stdout, s.dxhd.Stderr = os.Stdout, os.Stderr
+	if err := s.dxhd.Start(); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// waitReady presses the ready binding (ctrl + key), which every fixture has,
+// until dxhd has grabbed it and ran its command
+func (s *session) waitReady(key string) {
+	s.t.Helper()
+
+	ready := filepath.Join(s.dir, "ready")
+	deadline := time.Now().Add(time.Second * 10)
+	for !s.exists(ready) {
+		if time.Now().After(deadline) {
+			s.t.Fatal("dxhd did not grab its bindings in time")
+		}
+		s.tap("Control_L", key)
+		time.Sleep(time.Millisecond * 100)
+	}
+	if err := os.Remove(ready); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+// Close stops dxhd and Xvfb
+func (s *session) Close() {
+	if s.dxhd != nil && s.dxhd.Process != nil {
+		_ = s.dxhd.Process.Signal(syscall.SIGTERM)
+		_ = s.dxhd.Wait()
+	}
+	if s.X != nil {
+		s.X.Conn().Close()
+	}
+	if s.xvfb != nil && s.xvfb.Process != nil {
+		_ = s.xvfb.Process.Kill()
+		_ = s.xvfb.Wait()
+	}
+	_ = os.RemoveAll(s.dir)
+}
+
+func (s *session) fake(evtType byte, detail byte) {
+	s.t.Helper()
+
+	err := xtest.FakeInputChecked(s.X.Conn(), evtType, detail, 0, s.X.RootWin(), 0, 0, 0).Check()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func (s *session) keycode(key string) byte {
+	s.t.Helper()
+
+	keycodes := keybind.StrToKeycodes(s.X, key)
+	if len(keycodes) == 0 {
+		s.t.Fatalf("no keycode for %s", key)
+	}
+	return byte(keycodes[0])
+}
+
+// keyDown presses every given key in order
+func (s *session) keyDown(keys ...string) {
+	s.t.Helper()
+
+	for _, key := range keys {
+		s.fake(xproto.KeyPress, s.keycode(key))
+	}
+}
+
+// keyUp releases every given key in reverse order
+func (s *session) keyUp(keys ...string) {
+	s.t.Helper()
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		s.fake(xproto.KeyRelease, s.keycode(keys[i]))
+	}
+}
+
+// tap presses and releases given keys
+func (s *session) tap(keys ...string) {
+	s.t.Helper()
+
+	s.keyDown(keys...)
+	s.keyUp(keys...)
+}
+
+// click presses and releases given button whilst holding given modifier keys
+func (s *session) click(button byte, mods ...string) {
+	s.t.Helper()
+
+	s.keyDown(mods...)
+	s.fake(xproto.ButtonPress, button)
+	s.fake(xproto.ButtonRelease, button)
+	s.keyUp(mods...)
+}
+
+func (s *session) exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// expectFile waits for a command to write given content to a file in the session directory
+func (s *session) expectFile(name, content string) {
+	s.t.Helper()
+
+	path := filepath.Join(s.dir, name)
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		data, err := ioutil.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(data)) == content {
+			return
+		}
+		if time.Now().After(deadline) {
+			s.t.Fatalf("expected %s to contain %q, got %q (%v)", name, content, data, err)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+// expectNoFile makes sure no command wrote given file in a while
+func (s *session) expectNoFile(name string) {
+	s.t.Helper()
+
+	time.Sleep(time.Millisecond * 300)
+	if s.exists(filepath.Join(s.dir, name)) {
+		s.t.Fatalf("did not expect %s to be written", name)
+	}
+}
+
+func TestKeyPress(t *testing.T) {
+	s := newSession(t, "keys.sh")
+	defer s.Close()
+
+	s.tap("Super_L", "a")
+	s.expectFile("press", "a")
+
+	s.tap("Super_L", "Shift_L", "a")
+	s.expectFile("press", "shift a")
+}
+
+func TestKeyRelease(t *testing.T) {
+	s := newSession(t, "keys.sh")
+	defer s.Close()
+
+	s.keyDown("Super_L", "b")
+	s.expectNoFile("release")
+	s.keyUp("Super_L", "b")
+	s.expectFile("release", "b")
+}
+
+func TestVariants(t *testing.T) {
+	s := newSession(t, "keys.sh")
+	defer s.Close()
+
+	s.tap("Super_L", "3")
+	s.expectFile("workspace", "13")
+}
+
+func TestMouseBindings(t *testing.T) {
+	s := newSession(t, "mouse.sh")
+	defer s.Close()
+
+	s.click(1, "Super_L")
+	s.expectFile("button", "1")
+
+	s.click(3, "Super_L")
+	s.expectFile("released", "3")
+}
+
+func TestReload(t *testing.T) {
+	s := newSession(t, "keys.sh")
+	defer s.Close()
+
+	s.writeConfig("reloaded.sh")
+	if err := s.dxhd.Process.Signal(syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	// the reloaded config binds its ready command to a different key
+	s.waitReady("F11")
+
+	s.tap("Super_L", "a")
+	s.expectNoFile("press")
+
+	s.tap("Super_L", "z")
+	s.expectFile("reloaded", "z")
+}
+
+func TestKeyboardRemapped(t *testing.T) {
+	s := newSession(t, "keys.sh")
+	defer s.Close()
+
+	// move the keysyms of a to a keycode which has none, like setxkbmap may do
+	old := xproto.Keycode(s.keycode("a"))
+	mapping := keybind.KeyMapGet(s.X)
+	perKeycode := int(mapping.KeysymsPerKeycode)
+	min, max := s.X.Setup().MinKeycode, s.X.Setup().MaxKeycode
+	row := func(keycode xproto.Keycode) []xproto.Keysym {
+		at := int(keycode-min) * perKeycode
+		return mapping.Keysyms[at : at+perKeycode]
+	}
+
+	spare := xproto.Keycode(0)
+	for keycode := max; keycode > min && spare == 0; keycode-- {
+		empty := true
+		for _, keysym := range row(keycode) {
+			empty = empty && keysym == 0
+		}
+		if empty {
+			spare = keycode
+		}
+	}
+	if spare == 0 {
+		t.Skip("the keyboard mapping has no spare keycode")
+	}
+
+	keysyms := append([]xproto.Keysym{}, row(old)...)
+	remap := func(keycode xproto.Keycode, keysyms []xproto.Keysym) {
+		err := xproto.ChangeKeyboardMappingChecked(s.X.Conn(), 1, keycode, byte(perKeycode), keysyms).Check()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	remap(spare, keysyms)
+	remap(old, make([]xproto.Keysym, perKeycode))
+
+	// dxhd grabs super + a again on the new keycode once it's notified
+	super := s.keycode("Super_L")
+	deadline := time.Now().Add(time.Second * 5)
+	for !s.exists(filepath.Join(s.dir, "press")) {
+		if time.Now().After(deadline) {
+			t.Fatal("super + a was not grabbed again on its new keycode")
+		}
+		s.fake(xproto.KeyPress, super)
+		s.fake(xproto.KeyPress, byte(spare))
+		s.fake(xproto.KeyRelease, byte(spare))
+		s.fake(xproto.KeyRelease, super)
+		time.Sleep(time.Millisecond * 100)
+	}
+	s.expectFile("press", "a")
+}
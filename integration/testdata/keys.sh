@@ -0,0 +1,17 @@
+#!/bin/sh
+
+## used by the tests to know dxhd is ready
+# ctrl + F12
+touch "$DIR/ready"
+
+# super + a
+echo a > "$DIR/press"
+
+# super + shift + a
+echo shift a > "$DIR/press"
+
+# super + @b
+echo b > "$DIR/release"
+
+# super + {1-9}
+echo {11-19} > "$DIR/workspace"
@@ -0,0 +1,11 @@
+#!/bin/sh
+
+## used by the tests to know dxhd is ready
+# ctrl + F12
+touch "$DIR/ready"
+
+# super + mouse1
+echo 1 > "$DIR/button"
+
+# super + @mouse3
+echo 3 > "$DIR/released"
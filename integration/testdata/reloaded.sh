@@ -0,0 +1,8 @@
+#!/bin/sh
+
+## used by the tests to know dxhd is ready
+# ctrl + F11
+touch "$DIR/ready"
+
+# super + z
+echo z > "$DIR/reloaded"
@@ -0,0 +1,99 @@
+package listener
+
+import (
+	"errors"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// ErrConnectionLost is returned by Main when the connection to the X server drops
+var ErrConnectionLost = errors.New("connection to the X server was lost")
+
+// Key identifies a grabbed key or button by its modifiers and keycode/button number
+type Key struct {
+	Mods   uint16
+	Detail byte
+}
+
+// Event is a key or button event received from a backend
+type Event struct {
+	Type parser.EventType
+	Key  Key
+	// State is the raw modifier state, before the ignored modifiers were masked out of Key
+	State uint16
+	// Keysym is the name of the pressed key, it's empty for button events
+	Keysym string
+	// Time is the X server timestamp of the event
+	Time uint32
+	// RootX and RootY are the pointer coordinates relative to the root window
+	RootX, RootY int16
+	// Child is the child of the root window the pointer was in, if any
+	Child uint32
+	// Window is the focused window for key events and the window under the pointer for button events,
+	// it's only looked up for events some binding matched
+	Window uint32
+	// DeltaX and DeltaY are how far the pointer moved since a drag started
+	DeltaX, DeltaY int16
+	// Corner is the hot corner or edge the pointer reached
+	Corner string
+	// Device is the input device of a raw event
+	Device string
+	// Remapped is set, with no other field, once the keyboard mapping changed,
+	// the keys grabbed before may be stale and have to be grabbed again
+	Remapped bool
+}
+
+// Pointer is the state of the pointer
+type Pointer struct {
+	RootX, RootY int16
+	// Mods are the held modifiers, without the ignored ones
+	Mods  uint16
+	Child uint32
+}
+
+// Backend is everything a listener needs from an X server
+type Backend interface {
+	// Name describes the backend, e.g. the display it's connected to
+	Name() string
+	// Grab grabs a binding (in xgb format, e.g. mod4-shift-a) on the root window
+	// and returns the keys its events will be reported with
+	Grab(evtType parser.EventType, binding string) ([]Key, error)
+	// Keys returns the keys events of a binding are reported with, without grabbing it
+	Keys(evtType parser.EventType, binding string) ([]Key, error)
+	// Ungrab releases a key previously returned by Grab
+	Ungrab(evtType parser.EventType, key Key) error
+	// Events returns the stream of grabbed events, pointer motion whilst a grabbed button
+	// is held is reported as EvtButtonDrag and keyboard mapping changes as Remapped events,
+	// it's closed once the backend is closed or the connection drops
+	Events() <-chan Event
+	// FocusedWindow returns the id of the window which has the input focus
+	FocusedWindow() (uint32, error)
+	// Pointer queries the position of the pointer
+	Pointer() (Pointer, error)
+	// ScreenSize returns the size of the root window
+	ScreenSize() (width, height int)
+	// Close closes the connection, Events is closed afterwards
+	Close()
+}
+
+// Dialer opens a new connection to a backend
+type Dialer func() (Backend, error)
+
+// RawEvent is a key or button event of a specific input device, it's reported even when another client grabbed the key
+type RawEvent struct {
+	Type parser.EventType
+	// Detail is the keycode or the button number
+	Detail byte
+	Device string
+	Time   uint32
+}
+
+// RawInput reports raw input events along with the devices they come from
+type RawInput interface {
+	// Events returns the stream of raw events, it's closed once the input is closed or the connection drops
+	Events() <-chan RawEvent
+	Close()
+}
+
+// RawDialer opens a new connection to a raw input
+type RawDialer func() (RawInput, error)
@@ -0,0 +1,95 @@
+package listener
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// modifier masks in the order and with the names a config uses them
+var configModifiers = []struct {
+	mask uint16
+	name string
+}{
+	{xproto.ModMask4, "super"},
+	{xproto.ModMaskControl, "ctrl"},
+	{xproto.ModMask1, "alt"},
+	{xproto.ModMaskShift, "shift"},
+	{xproto.ModMask3, "mod3"},
+	{xproto.ModMask5, "mod5"},
+}
+
+// ConfigBinding formats modifiers and a key name in config syntax, e.g. super + shift + Prior
+func ConfigBinding(mods uint16, key string) string {
+	var parts []string
+	for _, m := range configModifiers {
+		if mods&m.mask != 0 {
+			parts = append(parts, m.name)
+		}
+	}
+	return strings.Join(append(parts, key), " + ")
+}
+
+// InspectKeys grabs the keyboard of given X display and writes every pressed key combination
+// in config syntax along with its translation, until escape is pressed without modifiers
+func InspectKeys(display string, w io.Writer) (err error) {
+	X, err := xgbutil.NewConnDisplay(display)
+	if err != nil {
+		return
+	}
+	defer X.Conn().Close()
+
+	keybind.Initialize(X)
+
+	err = keybind.GrabKeyboard(X, X.RootWin())
+	if err != nil {
+		return
+	}
+	defer keybind.UngrabKeyboard(X)
+
+	fmt.Fprintln(w, "press key combinations to see how to bind them, press escape to quit")
+
+	for {
+		ev, xerr := X.Conn().WaitForEvent()
+		if ev == nil && xerr == nil {
+			return ErrConnectionLost
+		}
+		if xerr != nil {
+			continue
+		}
+
+		press, ok := ev.(xproto.KeyPressEvent)
+		if !ok {
+			continue
+		}
+
+		// wait for a non-modifier key
+		if keybind.ModGet(X, press.Detail) != 0 {
+			continue
+		}
+
+		mods, keycode := keybind.DeduceKeyInfo(press.State, press.Detail)
+		key := keybind.KeysymToStr(keybind.KeysymGet(X, keycode, 0))
+		if key == "" {
+			fmt.Fprintf(w, "keycode %d has no keysym\n", keycode)
+			continue
+		}
+
+		if key == "Escape" && mods == 0 {
+			return
+		}
+
+		binding := ConfigBinding(mods, key)
+		translated, e := parser.Translate(binding)
+		if e != nil {
+			fmt.Fprintf(w, "%s\n  can not be translated (%s)\n", binding, e.Error())
+			continue
+		}
+		fmt.Fprintf(w, "%s\n  translates to %s\n", binding, translated)
+	}
+}
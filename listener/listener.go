@@ -1,85 +1,566 @@
 package listener
 
 import (
-	"bytes"
-	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/keybind"
-	"github.com/BurntSushi/xgbutil/mousebind"
-	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/dakyskye/dxhd/history"
 	"github.com/dakyskye/dxhd/logger"
 	"github.com/dakyskye/dxhd/parser"
+	"github.com/dakyskye/dxhd/systemd"
 	"github.com/sirupsen/logrus"
 )
 
-// ListenKeybinding does connect a keybinding/mousebinding to the Xorg server
-func ListenKeybinding(X *xgbutil.XUtil, errs chan<- error, evtType parser.EventType, shell, globals, keybinding, command string) (err error) {
-	switch evtType {
-	case parser.EvtKeyPress:
-		binding := keybind.KeyPressFun(func(xu *xgbutil.XUtil, event xevent.KeyPressEvent) {
-			go execCommand(errs, shell, globals, command)
-		})
-
-		logger.L().WithFields(logrus.Fields{"binding": keybinding, "command": command}).WithError(err).Debug("adding key press event")
-		err = binding.Connect(X, X.RootWin(), keybinding, true)
-	case parser.EvtKeyRelease:
-		binding := keybind.KeyReleaseFun(func(xu *xgbutil.XUtil, event xevent.KeyReleaseEvent) {
-			go execCommand(errs, shell, globals, command)
-		})
-
-		logger.L().WithFields(logrus.Fields{"binding": keybinding, "command": command}).WithError(err).Debug("adding key release event")
-		err = binding.Connect(X, X.RootWin(), keybinding, true)
-	case parser.EvtButtonPress:
-		binding := mousebind.ButtonPressFun(func(xu *xgbutil.XUtil, event xevent.ButtonPressEvent) {
-			go execCommand(errs, shell, globals, command)
-		})
+// grab identifies a grabbed key or button together with the event type it's bound to
+type grab struct {
+	evtType parser.EventType
+	key     Key
+}
+
+// Binding is a keybinding and the command it runs
+type Binding struct {
+	EvtType parser.EventType
+	// Original is the binding as written in the config, Binding is its translation to xgb format
+	Original string
+	Binding  string
+	Command  string
+	// Device restricts the binding to an input device, such bindings are matched against raw events
+	Device string
+	// Description is shown for the binding by menus
+	Description string
+}
+
+// Options configure how a listener runs the commands of its bindings
+type Options struct {
+	Shell   string
+	Globals string
+	// Results, if set, receives the result of every executed command
+	Results chan<- Result
+	// Ready, if set, is called by Serve once the bindings are registered, after each connect,
+	// with the number of bindings which could not be
+	Ready func(failed int)
+	// Waiting, if set, is called by Serve whenever it can not connect to Xorg, before it waits to try again
+	Waiting func(err error)
+	// Heartbeat, if set, is called every HeartbeatInterval from the event loop, and by Serve while it waits
+	// to connect to Xorg, telling neither is stuck
+	Heartbeat         func()
+	HeartbeatInterval time.Duration
+	// Scope runs every command but the ones of drags and hot corners in its own transient systemd scope
+	Scope bool
+	// Record, if set, is called with every received event
+	Record func(Record)
+	// RawInput, if set, is dialled by Serve for bindings restricted to an input device
+	RawInput RawDialer
+}
+
+// Listener holds the keybindings registered on a single backend
+type Listener struct {
+	// Exec runs the command of a binding triggered by an event, it executes the command
+	// in the config's shell by default, with the event described in its environment
+	Exec    func(b Binding, ev Event)
+	backend Backend
+	record  func(Record)
+	// mu guards the grabs, Main grabs the bindings again when the keyboard mapping changes while Quit may ungrab them,
+	// the reads of the goroutine running Main need no lock
+	mu       sync.Mutex
+	bindings map[grab][]Binding
+	corners  []hotCorner
+	zone     string
+	raw      RawInput
+	devices  map[grab][]Binding
+	drag     *drag
+	quitting int32
+	// registered are the registered bindings in the order of the config, for menus
+	registered []Binding
+
+	// heartbeat is called every heartbeatInterval from Main
+	heartbeat         func()
+	heartbeatInterval time.Duration
+}
+
+// New returns a listener for given backend
+func New(backend Backend, opts Options) *Listener {
+	l := &Listener{
+		backend:  backend,
+		record:   opts.Record,
+		bindings: make(map[grab][]Binding),
+		devices:  make(map[grab][]Binding),
+
+		heartbeat:         opts.Heartbeat,
+		heartbeatInterval: opts.HeartbeatInterval,
+	}
+	l.Exec = func(b Binding, ev Event) {
+		if program, ok := MenuProgram(b.Command); ok {
+			go openMenu(opts, program, l.menu(), ev)
+			return
+		}
+		go execCommand(opts, b, Environment(b, ev))
+	}
+	return l
+}
+
+// UseRawInput makes the listener match bindings restricted to an input device against raw events of given input,
+// it has to be called before registering such bindings, the listener closes the input once it quits
+func (l *Listener) UseRawInput(raw RawInput) {
+	l.raw = raw
+}
+
+// ListenKeybinding does connect a keybinding/mousebinding to the backend
+func (l *Listener) ListenKeybinding(b Binding) (err error) {
+	logger.L().WithFields(logrus.Fields{"binding": b.Binding, "command": b.Command, "event": b.EvtType}).Debug("adding a binding")
+
+	defer func() {
+		if err == nil {
+			l.registered = append(l.registered, b)
+		}
+	}()
+
+	// hot corners need no grab
+	if b.EvtType == parser.EvtHotCorner {
+		return l.listenHotCorner(b)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.grab(b)
+}
+
+// grab grabs the keys of a binding, or resolves them for a binding restricted to a device, l.mu has to be held
+func (l *Listener) grab(b Binding) error {
+	// raw events are reported without grabbing
+	if b.Device != "" {
+		return l.listenDevice(b)
+	}
+
+	keys, err := l.backend.Grab(b.EvtType, b.Binding)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		g := grab{evtType: b.EvtType, key: key}
+		l.bindings[g] = append(l.bindings[g], b)
+	}
+
+	return nil
+}
+
+// Main reads events from the backend and runs the commands bound to them,
+// it returns nil once Quit was called, or ErrConnectionLost if the connection drops
+func (l *Listener) Main() error {
+	events := l.backend.Events()
+
+	var raw <-chan RawEvent
+	if l.raw != nil {
+		raw = l.raw.Events()
+	}
 
-		logger.L().WithFields(logrus.Fields{"binding": keybinding, "command": command}).WithError(err).Debug("adding button press event")
-		err = binding.Connect(X, X.RootWin(), keybinding, false, true)
+	// hot corners are polled, as the root window does not get motion events over other windows
+	var poll <-chan time.Time
+	if len(l.corners) > 0 {
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	var heartbeat <-chan time.Time
+	if l.heartbeat != nil && l.heartbeatInterval > 0 {
+		ticker := time.NewTicker(l.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				if atomic.LoadInt32(&l.quitting) == 1 {
+					return nil
+				}
+				return ErrConnectionLost
+			}
+			l.handle(ev)
+		case ev, ok := <-raw:
+			if !ok {
+				logger.L().WithField("display", l.backend.Name()).Warn("lost the connection to XInput, device bindings won't work anymore")
+				raw = nil
+				continue
+			}
+			l.handleRaw(ev)
+		case <-poll:
+			l.pollCorners()
+		case <-heartbeat:
+			l.heartbeat()
+		}
+	}
+}
+
+// handle runs the commands bound to an event
+func (l *Listener) handle(ev Event) {
+	if ev.Remapped {
+		l.regrab()
+		return
+	}
+
+	if ev.Type == parser.EvtButtonDrag {
+		l.dragMotion(ev)
+		return
+	}
+
+	bindings := l.bindings[grab{evtType: ev.Type, key: ev.Key}]
+
+	if l.record != nil {
+		l.record(newRecord(l.backend.Name(), ev, bindings))
+	}
+
+	switch ev.Type {
+	case parser.EvtButtonPress:
+		l.dragStart(ev)
 	case parser.EvtButtonRelease:
-		binding := mousebind.ButtonReleaseFun(func(xu *xgbutil.XUtil, event xevent.ButtonReleaseEvent) {
-			go execCommand(errs, shell, globals, command)
-		})
+		l.dragEnd(ev)
+	}
+
+	if len(bindings) == 0 {
+		return
+	}
+
+	ev.Window = ev.Child
+	if ev.Type == parser.EvtKeyPress || ev.Type == parser.EvtKeyRelease {
+		window, err := l.backend.FocusedWindow()
+		if err != nil {
+			logger.L().WithError(err).Debug("can not get the focused window")
+		}
+		ev.Window = window
+	}
+
+	for _, b := range bindings {
+		l.Exec(b, ev)
+	}
+}
+
+// regrab grabs every binding again after the keyboard mapping changed, as their keys may have moved
+func (l *Listener) regrab() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// the grabs Quit released are not taken again
+	if atomic.LoadInt32(&l.quitting) == 1 {
+		return
+	}
+
+	logger.L().WithField("display", l.backend.Name()).Info("the keyboard mapping changed, grabbing the bindings again")
+
+	// everything is ungrabbed first, in case two keys were swapped
+	l.ungrab()
+	l.bindings = make(map[grab][]Binding)
+	l.devices = make(map[grab][]Binding)
+
+	for _, b := range l.registered {
+		if b.EvtType == parser.EvtHotCorner {
+			continue
+		}
+		if err := l.grab(b); err != nil {
+			logger.L().WithError(err).WithFields(logrus.Fields{"keybinding": b.Binding, "display": l.backend.Name()}).Warn("can not register a keybinding")
+		}
+	}
+}
+
+// ungrab releases every grab, l.mu has to be held
+func (l *Listener) ungrab() {
+	// every binding holds its own reference to a grab
+	for g, bindings := range l.bindings {
+		for range bindings {
+			err := l.backend.Ungrab(g.evtType, g.key)
+			if err != nil {
+				logger.L().WithError(err).Debug("can not ungrab a key")
+			}
+		}
+	}
+}
+
+// Quit releases every grab and closes the backend, which makes Main return
+func (l *Listener) Quit() {
+	atomic.StoreInt32(&l.quitting, 1)
+
+	l.mu.Lock()
+	l.ungrab()
+	l.mu.Unlock()
+
+	if l.raw != nil {
+		l.raw.Close()
+	}
+	l.backend.Close()
+}
+
+// Connect opens a connection using given dialer, retrying with an exponential backoff
+// until it succeeds or stop is closed, in which case it returns nil
+func Connect(name string, dial Dialer, stop <-chan struct{}) Backend {
+	return connect(name, dial, Options{}, stop)
+}
+
+// connect is Connect telling opts when it waits and beating while it does
+func connect(name string, dial Dialer, opts Options, stop <-chan struct{}) Backend {
+	const (
+		minDelay = time.Millisecond * 500
+		// retries are kept frequent, so dxhd comes back soon after Xorg restarts
+		maxDelay = time.Second * 5
+	)
+
+	var heartbeat <-chan time.Time
+	if opts.Heartbeat != nil && opts.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(opts.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	delay := minDelay
+	for {
+		backend, err := dial()
+		if err == nil {
+			return backend
+		}
+
+		logger.L().WithError(err).WithFields(logrus.Fields{"display": name, "retry": delay.String()}).Warn("can not open connection to Xorg")
+		if opts.Waiting != nil {
+			opts.Waiting(err)
+		}
+
+		if heartbeat != nil {
+			opts.Heartbeat()
+		}
+		retry := time.After(delay)
+	wait:
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-heartbeat:
+				opts.Heartbeat()
+			case <-retry:
+				break wait
+			}
+		}
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// Serve connects using given dialer, registers every binding and runs their commands,
+// reconnecting whenever the connection drops, until stop is closed
+func Serve(name string, dial Dialer, data []parser.FileData, opts Options, stop <-chan struct{}) {
+	for {
+		backend := connect(name, dial, opts, stop)
+		if backend == nil {
+			return
+		}
+
+		l := New(backend, opts)
+
+		if opts.RawInput != nil && needsRawInput(data) {
+			raw, err := opts.RawInput()
+			if err != nil {
+				logger.L().WithError(err).WithField("display", name).Warn("can not listen to XInput raw events, device bindings won't work")
+			} else {
+				l.UseRawInput(raw)
+			}
+		}
+
+		failed := 0
+		for _, d := range data {
+			err := l.ListenKeybinding(Binding{
+				EvtType:     d.EvtType,
+				Original:    d.OriginalBinding,
+				Binding:     d.Binding.String(),
+				Command:     d.Command.String(),
+				Device:      d.Device,
+				Description: d.Description,
+			})
+			if err != nil {
+				logger.L().WithFields(logrus.Fields{"keybinding": d.Binding.String(), "display": name}).WithError(err).Warn("can not register a keybinding")
+				failed++
+			}
+		}
+
+		if opts.Ready != nil {
+			opts.Ready(failed)
+		}
+
+		lost := make(chan error, 1)
+		go func() {
+			lost <- l.Main()
+		}()
+
+		select {
+		case <-stop:
+			l.Quit()
+			<-lost
+			return
+		case err := <-lost:
+			logger.L().WithError(err).WithField("display", name).Warn("reconnecting to Xorg and registering the bindings again")
+		}
+	}
+}
+
+// Environment describes the event which triggered a binding as environment variables for its command
+func Environment(b Binding, ev Event) []string {
+	env := []string{
+		"DXHD_BINDING=" + b.Original,
+		"DXHD_TIMESTAMP=" + strconv.FormatUint(uint64(ev.Time), 10),
+		"DXHD_ROOT_X=" + strconv.Itoa(int(ev.RootX)),
+		"DXHD_ROOT_Y=" + strconv.Itoa(int(ev.RootY)),
+		"DXHD_WINDOW=" + strconv.FormatUint(uint64(ev.Window), 10),
+	}
+
+	switch ev.Type {
+	case parser.EvtKeyPress, parser.EvtButtonPress:
+		env = append(env, "DXHD_EVENT=press")
+	case parser.EvtKeyRelease, parser.EvtButtonRelease:
+		env = append(env, "DXHD_EVENT=release")
+	case parser.EvtButtonDrag:
+		env = append(env, "DXHD_EVENT=motion")
+	case parser.EvtHotCorner:
+		env = append(env, "DXHD_EVENT=enter", "DXHD_CORNER="+ev.Corner)
+	}
+
+	switch ev.Type {
+	case parser.EvtKeyPress, parser.EvtKeyRelease:
+		env = append(env, "DXHD_KEYSYM="+ev.Keysym)
+	case parser.EvtButtonPress, parser.EvtButtonRelease, parser.EvtButtonDrag:
+		env = append(env, "DXHD_BUTTON="+strconv.Itoa(int(ev.Key.Detail)))
+	}
 
-		logger.L().WithFields(logrus.Fields{"binding": keybinding, "command": command}).WithError(err).Debug("adding button release event")
-		err = binding.Connect(X, X.RootWin(), keybinding, false, true)
-	default:
-		err = errors.New("wrong event type passed")
+	if ev.Device != "" {
+		env = append(env, "DXHD_DEVICE="+ev.Device)
 	}
 
+	if b.EvtType == parser.EvtButtonDrag {
+		env = append(env,
+			"DXHD_DELTA_X="+strconv.Itoa(int(ev.DeltaX)),
+			"DXHD_DELTA_Y="+strconv.Itoa(int(ev.DeltaY)),
+		)
+	}
+
+	return env
+}
+
+// Result describes an execution of a binding's command
+type Result struct {
+	Binding  Binding
+	Start    time.Time
+	Duration time.Duration
+	// Err is set if the command could not be started, the other fields are then zero
+	Err error
+	// ExitCode is -1 if the command was killed by a signal
+	ExitCode int
+	Signal   syscall.Signal
+	// Stderr is the last history.MaxOutput bytes the command wrote to stderr
+	Stderr string
+}
+
+// Failed reports whether the command could not be started or did not exit successfully
+func (r Result) Failed() bool {
+	return r.Err != nil || r.ExitCode != 0
+}
+
+// Entry returns the history entry of a result
+func (r Result) Entry() history.Entry {
+	return history.Entry{
+		Binding:  r.Binding.Original,
+		Command:  r.Binding.Command,
+		Start:    r.Start,
+		Duration: r.Duration,
+		ExitCode: r.ExitCode,
+		Stderr:   r.Stderr,
+	}
+}
+
+// stderrFile returns an unlinked temporary file for the stderr of a command, processes it starts in the background keep
+// writing into it after it exits, and not into a pipe dxhd would have to keep reading
+func stderrFile() (f *os.File, err error) {
+	if f, err = ioutil.TempFile("", "dxhd-stderr-"); err != nil {
+		return
+	}
+	err = os.Remove(f.Name())
+	if err != nil {
+		_ = f.Close()
+		f = nil
+	}
 	return
 }
 
-// execCommand executes a command in givel shell
-func execCommand(err chan<- error, shell, globals, command string) {
-	writer := new(bytes.Buffer)
-	cmd := exec.Command(shell)
-	if len(globals) > 0 {
-		cmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n%s", globals, command))
+// tail returns the last history.MaxOutput bytes written into f, reading it without moving the offset it shares with
+// the processes still writing into it
+func tail(f *os.File) string {
+	stat, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	buf := new(history.Buffer)
+	_, _ = io.Copy(buf, io.NewSectionReader(f, 0, stat.Size()))
+	return buf.String()
+}
+
+// execCommand executes the command of a binding in the shell of given options and sends its result
+func execCommand(opts Options, b Binding, env []string) {
+	res := Result{Binding: b}
+	defer func() {
+		if opts.Results != nil {
+			opts.Results <- res
+		}
+	}()
+
+	// stderr is read from a file once the shell exits, exec would otherwise wait for the processes the command started
+	// in the background to close it
+	stderr, err := stderrFile()
+	if err != nil {
+		res.Err = err
+		return
+	}
+	defer stderr.Close()
+
+	cmd := exec.Command(opts.Shell)
+	// drags run their command on every motion and hot corners whenever they are entered, too often for a scope each
+	if opts.Scope && b.EvtType != parser.EvtButtonDrag && b.EvtType != parser.EvtHotCorner {
+		cmd = systemd.ScopeCommand("dxhd: "+b.Original, opts.Shell)
+	}
+	if len(opts.Globals) > 0 {
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n%s", opts.Globals, b.Command))
 	} else {
-		cmd.Stdin = strings.NewReader(command)
+		cmd.Stdin = strings.NewReader(b.Command)
 	}
+	cmd.Env = append(os.Environ(), env...)
 	cmd.Stdout = os.Stdout
-	cmd.Stderr = writer
+	cmd.Stderr = stderr
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Foreground: false,
 		Setsid:     true,
 	}
-	logger.L().WithTime(time.Now()).WithField("command", command).WithField("globals", globals).Debug("now executing a command")
-	err <- cmd.Start()
-	if e := cmd.Wait(); e != nil {
-		prefixLen := len(shell) + 2
-		if writer.Len() > prefixLen {
-			err <- errors.New(writer.String()[prefixLen:])
-		} else {
-			err <- e
-		}
+	logger.L().WithTime(time.Now()).WithField("command", b.Command).WithField("globals", opts.Globals).Debug("now executing a command")
+
+	start := time.Now()
+	if res.Err = cmd.Start(); res.Err != nil {
+		return
+	}
+	res.Start = start
+
+	// exit errors are described by the process state
+	_ = cmd.Wait()
+	res.Duration = time.Since(res.Start)
+	res.ExitCode = cmd.ProcessState.ExitCode()
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		res.Signal = status.Signal()
 	}
+
+	res.Stderr = tail(stderr)
 }
@@ -0,0 +1,648 @@
+package listener_test
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/dakyskye/dxhd/listener"
+	"github.com/dakyskye/dxhd/listener/listenertest"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// newListener returns a listener on a fake backend, recording ran commands into the returned channel
+func newListener(t *testing.T) (*listener.Listener, *listenertest.Backend, chan string) {
+	t.Helper()
+
+	backend := listenertest.New()
+	l := listener.New(backend, listener.Options{Shell: "/bin/sh"})
+	ran := make(chan string, 16)
+	l.Exec = func(b listener.Binding, ev listener.Event) {
+		ran <- b.Command
+	}
+	return l, backend, ran
+}
+
+func expectCommand(t *testing.T, ran <-chan string, want string) {
+	t.Helper()
+
+	select {
+	case got := <-ran:
+		if got != want {
+			t.Fatalf("expected %q to run, %q ran instead", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected %q to run, nothing ran", want)
+	}
+}
+
+func expectNoCommand(t *testing.T, ran <-chan string) {
+	t.Helper()
+
+	select {
+	case got := <-ran:
+		t.Fatalf("expected nothing to run, %q ran", got)
+	default:
+	}
+}
+
+func TestListenerRunsBoundCommands(t *testing.T) {
+	l, backend, ran := newListener(t)
+
+	bindings := []struct {
+		evtType  parser.EventType
+		binding  string
+		command  string
+		received parser.EventType
+	}{
+		{parser.EvtKeyPress, "mod4-a", "echo press", parser.EvtKeyPress},
+		{parser.EvtKeyRelease, "mod4-a", "echo release", parser.EvtKeyRelease},
+		{parser.EvtButtonPress, "mod4-1", "echo button", parser.EvtButtonPress},
+	}
+
+	for _, b := range bindings {
+		if err := l.ListenKeybinding(listener.Binding{EvtType: b.evtType, Binding: b.binding, Command: b.command}); err != nil {
+			t.Fatalf("can not listen %s: %v", b.binding, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Main()
+	}()
+
+	for _, b := range bindings {
+		if err := backend.Send(b.received, b.binding); err != nil {
+			t.Fatal(err)
+		}
+		expectCommand(t, ran, b.command)
+	}
+
+	// nothing is bound to a button release
+	if err := backend.Send(parser.EvtButtonRelease, "mod4-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Quit()
+	if err := <-done; err != nil {
+		t.Fatalf("expected Main to return nil after Quit, got %v", err)
+	}
+	expectNoCommand(t, ran)
+
+	for _, b := range bindings {
+		if backend.Grabbed(b.evtType, b.binding) {
+			t.Errorf("expected %s to be ungrabbed after Quit", b.binding)
+		}
+	}
+}
+
+func TestListenerDescribesEvents(t *testing.T) {
+	l, backend, _ := newListener(t)
+	backend.Focused = 42
+
+	envs := make(chan []string, 1)
+	l.Exec = func(b listener.Binding, ev listener.Event) {
+		envs <- listener.Environment(b, ev)
+	}
+
+	err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyRelease, Original: "super+@a", Binding: "mod4-a", Command: "echo a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = l.Main()
+	}()
+	defer l.Quit()
+
+	if err = backend.Send(parser.EvtKeyRelease, "mod4-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	env := strings.Join(<-envs, "\n")
+	for _, want := range []string{"DXHD_BINDING=super+@a", "DXHD_EVENT=release", "DXHD_WINDOW=42"} {
+		if !strings.Contains(env, want) {
+			t.Errorf("expected the environment to contain %s, got\n%s", want, env)
+		}
+	}
+}
+
+func TestListenerDrags(t *testing.T) {
+	l, backend, _ := newListener(t)
+
+	interval := listener.DragInterval
+	listener.DragInterval = 0
+	defer func() {
+		listener.DragInterval = interval
+	}()
+
+	deltas := make(chan string, 4)
+	l.Exec = func(b listener.Binding, ev listener.Event) {
+		deltas <- fmt.Sprintf("%s %d,%d", ev.Type, ev.DeltaX, ev.DeltaY)
+	}
+
+	err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtButtonDrag, Binding: "mod4-1", Command: "echo drag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = l.Main()
+	}()
+	defer l.Quit()
+
+	steps := []struct {
+		evtType parser.EventType
+		x, y    int16
+		want    string
+	}{
+		{parser.EvtButtonPress, 10, 10, "button-press 0,0"},
+		{parser.EvtButtonDrag, 30, 5, "button-drag 20,-5"},
+		{parser.EvtButtonRelease, 40, 0, "button-release 30,-10"},
+	}
+	for _, step := range steps {
+		if err = backend.SendAt(step.evtType, "mod4-1", step.x, step.y); err != nil {
+			t.Fatal(err)
+		}
+		expectCommand(t, deltas, step.want)
+	}
+
+	// motion after the release is not a drag anymore
+	if err = backend.SendAt(parser.EvtButtonDrag, "mod4-1", 50, 50); err != nil {
+		t.Fatal(err)
+	}
+	expectNoCommand(t, deltas)
+}
+
+func TestListenerHotCorners(t *testing.T) {
+	l, backend, ran := newListener(t)
+
+	interval := listener.PollInterval
+	listener.PollInterval = time.Millisecond
+	defer func() {
+		listener.PollInterval = interval
+	}()
+
+	backend.MovePointer(500, 500, 0)
+	for _, b := range []listener.Binding{
+		{EvtType: parser.EvtHotCorner, Binding: "corner_top_left", Command: "echo top left"},
+		{EvtType: parser.EvtHotCorner, Binding: "mod4-edge_right", Command: "echo right"},
+	} {
+		if err := l.ListenKeybinding(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtHotCorner, Binding: "corner_middle"}); err == nil {
+		t.Error("expected an unknown corner to be rejected")
+	}
+
+	go func() {
+		_ = l.Main()
+	}()
+	defer l.Quit()
+
+	backend.MovePointer(0, 0, 0)
+	expectCommand(t, ran, "echo top left")
+
+	// the modifier is not held
+	backend.MovePointer(int16(backend.Width-1), 500, 0)
+	time.Sleep(time.Millisecond * 20)
+	expectNoCommand(t, ran)
+
+	backend.MovePointer(500, 500, 0)
+	time.Sleep(time.Millisecond * 20)
+	backend.MovePointer(int16(backend.Width-1), 500, xproto.ModMask4)
+	expectCommand(t, ran, "echo right")
+}
+
+func TestListenerReportsResults(t *testing.T) {
+	backend := listenertest.New()
+	results := make(chan listener.Result, 1)
+	l := listener.New(backend, listener.Options{Shell: "/bin/sh", Results: results})
+
+	commands := []struct {
+		binding, command string
+		check            func(listener.Result) bool
+	}{
+		{"mod4-a", "echo out; echo err >&2; exit 3", func(r listener.Result) bool {
+			return r.Err == nil && r.ExitCode == 3 && r.Stderr == "err\n" && r.Failed()
+		}},
+		{"mod4-b", "kill -TERM $$", func(r listener.Result) bool {
+			return r.Signal == syscall.SIGTERM && r.Failed()
+		}},
+		{"mod4-c", "true", func(r listener.Result) bool {
+			return !r.Failed()
+		}},
+	}
+
+	for _, c := range commands {
+		err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Original: c.binding, Binding: c.binding, Command: c.command})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	go l.Main()
+	defer l.Quit()
+
+	for _, c := range commands {
+		if err := backend.Send(parser.EvtKeyPress, c.binding); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case res := <-results:
+			if res.Binding.Original != c.binding || !c.check(res) {
+				t.Fatalf("unexpected result of %q: %+v", c.command, res)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("expected a result of %q", c.command)
+		}
+	}
+}
+
+func TestListenerDoesNotWaitForBackgroundProcesses(t *testing.T) {
+	backend := listenertest.New()
+	results := make(chan listener.Result, 1)
+	l := listener.New(backend, listener.Options{Shell: "/bin/sh", Results: results})
+
+	// the background process inherits stderr, and keeps writing into it after the shell exited
+	if err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Original: "super+a", Binding: "mod4-a", Command: "(sleep 1; echo late >&2) & echo started >&2"}); err != nil {
+		t.Fatal(err)
+	}
+	go l.Main()
+	defer l.Quit()
+
+	if err := backend.Send(parser.EvtKeyPress, "mod4-a"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-results:
+		if res.Failed() || res.Stderr != "started\n" {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the result as soon as the shell exited")
+	}
+}
+
+func TestListenerMenu(t *testing.T) {
+	backend := listenertest.New()
+	results := make(chan listener.Result, 1)
+	l := listener.New(backend, listener.Options{Shell: "/bin/sh", Results: results})
+
+	bindings := []listener.Binding{
+		{EvtType: parser.EvtKeyPress, Original: "super+a", Binding: "mod4-a", Command: "echo a", Description: "first"},
+		{EvtType: parser.EvtKeyPress, Original: "super+b", Binding: "mod4-b", Command: "echo b >&2", Description: "second"},
+		// the menu program picks the line of the second binding, the menus themselves are not offered
+		{EvtType: parser.EvtKeyPress, Original: "super+slash", Binding: "mod4-slash", Command: "@menu grep -v first"},
+		{EvtType: parser.EvtKeyPress, Original: "super+c", Binding: "mod4-c", Command: "@menu false"},
+	}
+	for _, b := range bindings {
+		if err := l.ListenKeybinding(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go l.Main()
+	defer l.Quit()
+
+	if err := backend.Send(parser.EvtKeyPress, "mod4-slash"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-results:
+		if res.Binding.Original != "super+b" || res.Stderr != "b\n" {
+			t.Fatalf("expected the chosen binding to run, got %+v", res)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the chosen binding to run")
+	}
+
+	// nothing is chosen when the menu fails
+	if err := backend.Send(parser.EvtKeyPress, "mod4-c"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-results:
+		t.Fatalf("expected nothing to run, got %+v", res)
+	case <-time.After(time.Millisecond * 200):
+	}
+}
+
+func TestReplayMatchesKeysymsOfSeveralNames(t *testing.T) {
+	var data []parser.FileData
+	_, _, err := parser.Parse([]byte("#!/bin/sh\n# super + Page_Up\necho up\n# super + next\necho down\n# super + F11\necho f11\n"), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the keysyms were recorded by other names of theirs
+	var recording strings.Builder
+	for _, keysym := range []string{"Prior", "Page_Down", "L1", "Home"} {
+		fmt.Fprintf(&recording, `{"event":"key-press","mods":%d,"keysym":%q}`+"\n", xproto.ModMask4, keysym)
+	}
+
+	var out strings.Builder
+	if err = listener.Replay(strings.NewReader(recording.String()), data, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"echo up", "echo down", "echo f11"} {
+		if !strings.Contains(out.String(), "command:\n"+command+"\n") {
+			t.Errorf("expected %q to run, got\n%s", command, out.String())
+		}
+	}
+	if strings.Count(out.String(), "no binding matched") != 1 {
+		t.Errorf("expected Home to match no binding, got\n%s", out.String())
+	}
+}
+
+func TestMenuProgram(t *testing.T) {
+	tests := map[string]string{
+		"@menu":             listener.DefaultMenu,
+		"  @menu dmenu \n":  "dmenu",
+		"@menu rofi -dmenu": "rofi -dmenu",
+		"@menus":            "",
+		"@menu dmenu\necho": "",
+		"echo @menu":        "",
+	}
+	for command, want := range tests {
+		program, ok := listener.MenuProgram(command)
+		if program != want || ok != (want != "") {
+			t.Errorf("%q: expected %q, got %q", command, want, program)
+		}
+	}
+}
+
+func TestListenerReportsStartErrors(t *testing.T) {
+	backend := listenertest.New()
+	results := make(chan listener.Result, 1)
+	l := listener.New(backend, listener.Options{Shell: "/nonexistent/shell", Results: results})
+
+	if err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Binding: "mod4-a", Command: "true"}); err != nil {
+		t.Fatal(err)
+	}
+	go l.Main()
+	defer l.Quit()
+
+	if err := backend.Send(parser.EvtKeyPress, "mod4-a"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case res := <-results:
+		if res.Err == nil || !res.Failed() {
+			t.Fatalf("expected a start error, got %+v", res)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected a result")
+	}
+}
+
+func TestListenerHeartbeat(t *testing.T) {
+	backend := listenertest.New()
+	beats := make(chan struct{}, 1)
+	l := listener.New(backend, listener.Options{Shell: "/bin/sh", HeartbeatInterval: time.Millisecond * 10, Heartbeat: func() {
+		select {
+		case beats <- struct{}{}:
+		default:
+		}
+	}})
+	go l.Main()
+	defer l.Quit()
+
+	select {
+	case <-beats:
+	case <-time.After(time.Second):
+		t.Fatal("expected the event loop to beat")
+	}
+}
+
+func TestServeBeatsWhileWaitingForXorg(t *testing.T) {
+	waiting, beats := make(chan error, 1), make(chan struct{}, 1)
+	opts := listener.Options{
+		Shell:             "/bin/sh",
+		HeartbeatInterval: time.Millisecond * 10,
+		Heartbeat: func() {
+			select {
+			case beats <- struct{}{}:
+			default:
+			}
+		},
+		Waiting: func(err error) {
+			select {
+			case waiting <- err:
+			default:
+			}
+		},
+	}
+	dial := func() (listener.Backend, error) {
+		return nil, fmt.Errorf("no Xorg")
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		listener.Serve("fake", dial, nil, opts, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	select {
+	case err := <-waiting:
+		if err == nil {
+			t.Fatal("expected the error of the connection")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected Serve to tell it waits for Xorg")
+	}
+	select {
+	case <-beats:
+	case <-time.After(time.Second):
+		t.Fatal("expected Serve to beat while it waits")
+	}
+}
+
+func TestListenerReportsTakenBindings(t *testing.T) {
+	l, backend, _ := newListener(t)
+	backend.Taken["mod4-a"] = true
+
+	if err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Binding: "mod4-a", Command: "echo a"}); err == nil {
+		t.Fatal("expected grabbing a taken binding to fail")
+	}
+}
+
+func TestListenerRegrabsAfterRemapping(t *testing.T) {
+	l, backend, ran := newListener(t)
+
+	if err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Binding: "mod4-a", Command: "echo a"}); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := backend.Keys(parser.EvtKeyPress, "mod4-a")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Main()
+	}()
+
+	backend.Remap()
+	if err := backend.Send(parser.EvtKeyPress, "mod4-a"); err != nil {
+		t.Fatal(err)
+	}
+	expectCommand(t, ran, "echo a")
+
+	if backend.GrabbedKey(parser.EvtKeyPress, old[0]) {
+		t.Error("expected the key of before the remapping to be ungrabbed")
+	}
+	if !backend.Grabbed(parser.EvtKeyPress, "mod4-a") {
+		t.Error("expected the binding to be grabbed on its new key")
+	}
+
+	l.Quit()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerQuitWhileRegrabbing(t *testing.T) {
+	l, backend, _ := newListener(t)
+
+	for i := 0; i < 50; i++ {
+		binding := fmt.Sprintf("mod4-%d", i)
+		if err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Binding: binding, Command: "true"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Main()
+	}()
+
+	// Main grabs the bindings again while Quit ungrabs them, which go test -race checks
+	backend.Remap()
+	l.Quit()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerDeviceBindings(t *testing.T) {
+	l, backend, ran := newListener(t)
+	raw := listenertest.NewRawInput()
+	l.UseRawInput(raw)
+
+	b := listener.Binding{EvtType: parser.EvtKeyPress, Binding: "a", Command: "echo tartarus", Device: "Razer Tartarus"}
+	if err := l.ListenKeybinding(b); err != nil {
+		t.Fatal(err)
+	}
+	if backend.Grabbed(parser.EvtKeyPress, "a") {
+		t.Fatal("expected a device binding not to grab its key")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Main()
+	}()
+
+	if err := raw.Send(backend, parser.EvtKeyPress, "a", "AT Translated Set 2 keyboard"); err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Send(backend, parser.EvtKeyRelease, "a", "Razer Tartarus"); err != nil {
+		t.Fatal(err)
+	}
+	expectNoCommand(t, ran)
+
+	if err := raw.Send(backend, parser.EvtKeyPress, "a", "Razer Tartarus"); err != nil {
+		t.Fatal(err)
+	}
+	expectCommand(t, ran, "echo tartarus")
+
+	// the release is bound to nothing, so it's not looked into
+	if queries := backend.PointerQueries(); queries != 2 {
+		t.Fatalf("expected the pointer to be queried for the 2 presses only, got %d", queries)
+	}
+
+	l.Quit()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerDeviceBindingsNeedRawInput(t *testing.T) {
+	l, _, _ := newListener(t)
+
+	err := l.ListenKeybinding(listener.Binding{EvtType: parser.EvtKeyPress, Binding: "a", Command: "echo a", Device: "Razer Tartarus"})
+	if err == nil {
+		t.Fatal("expected a device binding without raw input to fail")
+	}
+}
+
+func TestListenerConnectionLost(t *testing.T) {
+	l, backend, _ := newListener(t)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Main()
+	}()
+
+	backend.Drop()
+	if err := <-done; err != listener.ErrConnectionLost {
+		t.Fatalf("expected %v, got %v", listener.ErrConnectionLost, err)
+	}
+}
+
+func TestServeReconnects(t *testing.T) {
+	var data []parser.FileData
+	_, _, err := parser.Parse([]byte("#!/bin/sh\n# super + a\necho a\n"), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backends := make(chan *listenertest.Backend, 2)
+	dial := func() (listener.Backend, error) {
+		backend := listenertest.New()
+		backends <- backend
+		return backend, nil
+	}
+
+	ready := make(chan struct{}, 2)
+	opts := listener.Options{Shell: "/bin/sh", Ready: func(failed int) {
+		if failed != 0 {
+			t.Errorf("expected every binding to be registered, %d were not", failed)
+		}
+		ready <- struct{}{}
+	}}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		listener.Serve("fake", dial, data, opts, stop)
+		close(done)
+	}()
+
+	first := <-backends
+	first.Drop()
+
+	second := <-backends
+	// the event loop only starts once every binding is registered
+	if err := second.Send(parser.EvtKeyRelease, "mod4-a"); err != nil {
+		t.Fatal(err)
+	}
+	if !second.Grabbed(parser.EvtKeyPress, "mod4-a") {
+		t.Error("expected the bindings to be registered again after reconnecting")
+	}
+	if len(ready) != 2 {
+		t.Errorf("expected readiness to be reported after each connect, got %d reports", len(ready))
+	}
+
+	close(stop)
+	<-done
+
+	if second.Grabbed(parser.EvtKeyPress, "mod4-a") {
+		t.Error("expected the bindings to be ungrabbed once serving stopped")
+	}
+}
@@ -0,0 +1,267 @@
+// Package listenertest provides an in-memory backend for testing code built on the listener package
+package listenertest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dakyskye/dxhd/listener"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// Backend is an in-memory listener.Backend, every distinct binding is given its own key
+type Backend struct {
+	// Taken holds bindings another client has already grabbed, grabbing them fails
+	Taken map[string]bool
+	// Focused is returned by FocusedWindow
+	Focused uint32
+	// Width and Height are returned by ScreenSize
+	Width, Height int
+
+	pointer listener.Pointer
+	queries int
+	keys    map[string]listener.Key
+	grabs   map[grabKey]int
+	events  chan listener.Event
+	closed  bool
+	mu      sync.Mutex
+}
+
+type grabKey struct {
+	evtType parser.EventType
+	key     listener.Key
+}
+
+// New returns an empty fake backend
+func New() *Backend {
+	return &Backend{
+		Taken:  make(map[string]bool),
+		Width:  1920,
+		Height: 1080,
+		keys:   make(map[string]listener.Key),
+		grabs:  make(map[grabKey]int),
+		events: make(chan listener.Event),
+	}
+}
+
+// Dialer returns a dialer handing out b
+func (b *Backend) Dialer() listener.Dialer {
+	return func() (listener.Backend, error) {
+		return b, nil
+	}
+}
+
+// Name implements listener.Backend
+func (b *Backend) Name() string {
+	return "fake"
+}
+
+// key returns the key given to a binding, b.mu must be held
+func (b *Backend) key(binding string) listener.Key {
+	key, ok := b.keys[binding]
+	if !ok {
+		key = listener.Key{Detail: byte(len(b.keys) + 1)}
+		b.keys[binding] = key
+	}
+	return key
+}
+
+// Keys implements listener.Backend
+func (b *Backend) Keys(evtType parser.EventType, binding string) ([]listener.Key, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return []listener.Key{b.key(binding)}, nil
+}
+
+// Grab implements listener.Backend
+func (b *Backend) Grab(evtType parser.EventType, binding string) ([]listener.Key, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Taken[binding] {
+		return nil, fmt.Errorf("%s is already grabbed by another client", binding)
+	}
+
+	key := b.key(binding)
+	b.grabs[grabKey{evtType: evtType, key: key}]++
+
+	return []listener.Key{key}, nil
+}
+
+// Ungrab implements listener.Backend
+func (b *Backend) Ungrab(evtType parser.EventType, key listener.Key) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := grabKey{evtType: evtType, key: key}
+	if b.grabs[g] == 0 {
+		return fmt.Errorf("%v is not grabbed", key)
+	}
+	b.grabs[g]--
+	if b.grabs[g] == 0 {
+		delete(b.grabs, g)
+	}
+	return nil
+}
+
+// Grabbed reports whether binding is currently grabbed for given event type
+func (b *Backend) Grabbed(evtType parser.EventType, binding string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key, ok := b.keys[binding]
+	return ok && b.grabs[grabKey{evtType: evtType, key: key}] > 0
+}
+
+// Events implements listener.Backend
+func (b *Backend) Events() <-chan listener.Event {
+	return b.events
+}
+
+// FocusedWindow implements listener.Backend
+func (b *Backend) FocusedWindow() (uint32, error) {
+	return b.Focused, nil
+}
+
+// Pointer implements listener.Backend
+func (b *Backend) Pointer() (listener.Pointer, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.queries++
+	return b.pointer, nil
+}
+
+// PointerQueries returns how many times the pointer was queried
+func (b *Backend) PointerQueries() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.queries
+}
+
+// MovePointer moves the pointer, hot corners notice it on their next poll
+func (b *Backend) MovePointer(x, y int16, mods uint16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pointer = listener.Pointer{RootX: x, RootY: y, Mods: mods}
+}
+
+// ScreenSize implements listener.Backend
+func (b *Backend) ScreenSize() (width, height int) {
+	return b.Width, b.Height
+}
+
+// Close implements listener.Backend, just like closing an X connection it releases every grab
+func (b *Backend) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.grabs = make(map[grabKey]int)
+	if !b.closed {
+		b.closed = true
+		close(b.events)
+	}
+}
+
+// Drop simulates the connection to the X server dropping
+func (b *Backend) Drop() {
+	b.Close()
+}
+
+// Remap simulates a keyboard mapping change moving every binding to a new key, as setxkbmap may do,
+// it blocks until the listener receives the Remapped event
+func (b *Backend) Remap() {
+	b.mu.Lock()
+	for binding, key := range b.keys {
+		key.Detail += 100
+		b.keys[binding] = key
+	}
+	b.mu.Unlock()
+
+	b.events <- listener.Event{Remapped: true}
+}
+
+// GrabbedKey reports whether a key is currently grabbed for given event type, whichever binding it belongs to
+func (b *Backend) GrabbedKey(evtType parser.EventType, key listener.Key) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.grabs[grabKey{evtType: evtType, key: key}] > 0
+}
+
+// Send injects an event of binding as if the X server had sent it, it blocks until the listener receives it
+func (b *Backend) Send(evtType parser.EventType, binding string) error {
+	return b.SendAt(evtType, binding, 0, 0)
+}
+
+// SendAt is Send with the pointer at given coordinates
+func (b *Backend) SendAt(evtType parser.EventType, binding string, x, y int16) error {
+	b.mu.Lock()
+	key, ok := b.keys[binding]
+	b.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%s was never grabbed", binding)
+	}
+
+	ev := listener.Event{Type: evtType, Key: key, RootX: x, RootY: y}
+	if evtType == parser.EvtKeyPress || evtType == parser.EvtKeyRelease {
+		ev.Keysym = binding[strings.LastIndex(binding, "-")+1:]
+	}
+
+	b.events <- ev
+	return nil
+}
+
+// RawInput is an in-memory listener.RawInput
+type RawInput struct {
+	events chan listener.RawEvent
+	closed bool
+	mu     sync.Mutex
+}
+
+// NewRawInput returns a fake raw input
+func NewRawInput() *RawInput {
+	return &RawInput{events: make(chan listener.RawEvent)}
+}
+
+// Dialer returns a raw dialer handing out r
+func (r *RawInput) Dialer() listener.RawDialer {
+	return func() (listener.RawInput, error) {
+		return r, nil
+	}
+}
+
+// Events implements listener.RawInput
+func (r *RawInput) Events() <-chan listener.RawEvent {
+	return r.events
+}
+
+// Close implements listener.RawInput
+func (r *RawInput) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+}
+
+// Send injects a raw event of binding, as resolved by b, coming from device, it blocks until the listener receives it
+func (r *RawInput) Send(b *Backend, evtType parser.EventType, binding, device string) error {
+	b.mu.Lock()
+	key, ok := b.keys[binding]
+	b.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%s was never resolved", binding)
+	}
+
+	r.events <- listener.RawEvent{Type: evtType, Detail: key.Detail, Device: device}
+	return nil
+}
@@ -0,0 +1,82 @@
+package listener
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/dakyskye/dxhd/logger"
+	"github.com/dakyskye/dxhd/parser"
+	"github.com/sirupsen/logrus"
+)
+
+// MenuAction is the command reserved for bindings opening a menu of every other binding, running the chosen one,
+// it may be followed by the menu program, like @menu dmenu
+const MenuAction = "@menu"
+
+// DefaultMenu is the menu program of a bare @menu
+const DefaultMenu = "rofi"
+
+// Menus are the menu programs known by name, any other program is run by the shell, reading the entries from its stdin
+// and printing the chosen one, menus are graphical since dxhd has no terminal
+var Menus = map[string][]string{
+	"rofi":  {"rofi", "-dmenu", "-i", "-p", "dxhd"},
+	"dmenu": {"dmenu", "-i", "-l", "20", "-p", "dxhd"},
+}
+
+// MenuProgram returns the menu program of a binding's command, ok is false if the command is not the menu action
+func MenuProgram(command string) (program string, ok bool) {
+	command = strings.TrimSpace(command)
+	switch {
+	case command == MenuAction:
+		return DefaultMenu, true
+	case strings.HasPrefix(command, MenuAction+" ") && !strings.Contains(command, "\n"):
+		return strings.TrimSpace(strings.TrimPrefix(command, MenuAction)), true
+	}
+	return
+}
+
+// menu returns the registered bindings a menu offers, the menus themselves excluded
+func (l *Listener) menu() (bindings []Binding) {
+	for _, b := range l.registered {
+		if _, ok := MenuProgram(b.Command); !ok {
+			bindings = append(bindings, b)
+		}
+	}
+	return
+}
+
+// openMenu lets the user choose one of the bindings in given menu program, and runs the command of the chosen one
+// as if its own event was ev
+func openMenu(opts Options, program string, bindings []Binding, ev Event) {
+	var labels, summaries []string
+	for _, b := range bindings {
+		labels = append(labels, parser.Label(b.Original, b.Device))
+		summaries = append(summaries, parser.Summary(b.Description, b.Command))
+	}
+	lines := parser.Align(labels, summaries)
+
+	cmd := exec.Command(opts.Shell, "-c", program)
+	if args, ok := Menus[program]; ok {
+		cmd = exec.Command(args[0], args[1:]...)
+	}
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+
+	out, err := cmd.Output()
+	if _, closed := err.(*exec.ExitError); closed {
+		// menus exit unsuccessfully when they are closed without a choice
+		logger.L().WithError(err).WithField("menu", program).Debug("nothing was chosen from the menu")
+		return
+	} else if err != nil {
+		logger.L().WithError(err).WithField("menu", program).Warn("can not open the menu")
+		return
+	}
+
+	chosen := strings.TrimSuffix(string(out), "\n")
+	for i, line := range lines {
+		if line == chosen {
+			execCommand(opts, bindings[i], Environment(bindings[i], ev))
+			return
+		}
+	}
+	logger.L().WithFields(logrus.Fields{"menu": program, "chosen": chosen}).Debug("the menu chose no binding")
+}
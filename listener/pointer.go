@@ -0,0 +1,164 @@
+package listener
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dakyskye/dxhd/logger"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+var (
+	// PollInterval is how often the pointer is polled for hot corners
+	PollInterval = time.Millisecond * 100
+	// DragInterval is the least time between two runs of a drag binding's command whilst the pointer moves
+	DragInterval = time.Millisecond * 50
+)
+
+// hotCorner is a hot corner binding
+type hotCorner struct {
+	mods    uint16
+	corner  string
+	binding Binding
+}
+
+// drag is an ongoing drag of a button with drag bindings
+type drag struct {
+	button           byte
+	originX, originY int16
+	bindings         []Binding
+	last             time.Time
+}
+
+// listenHotCorner registers a hot corner binding, e.g. mod4-corner_top_left
+func (l *Listener) listenHotCorner(b Binding) error {
+	c := hotCorner{binding: b}
+	for _, part := range strings.Split(b.Binding, "-") {
+		if mask, ok := modMasks[strings.ToLower(part)]; ok {
+			c.mods |= mask
+		} else if c.corner == "" {
+			c.corner = part
+		}
+	}
+
+	for _, corner := range parser.HotCorners {
+		if corner == c.corner {
+			l.corners = append(l.corners, c)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a hot corner", c.corner)
+}
+
+// zone returns the corner or the edge of the screen a point is at, if any
+func zone(x, y, width, height int) string {
+	var vertical, horizontal string
+	switch {
+	case y <= 0:
+		vertical = "top"
+	case y >= height-1:
+		vertical = "bottom"
+	}
+	switch {
+	case x <= 0:
+		horizontal = "left"
+	case x >= width-1:
+		horizontal = "right"
+	}
+
+	switch {
+	case vertical != "" && horizontal != "":
+		return "corner_" + vertical + "_" + horizontal
+	case vertical != "":
+		return "edge_" + vertical
+	case horizontal != "":
+		return "edge_" + horizontal
+	default:
+		return ""
+	}
+}
+
+// pollCorners runs hot corner bindings once the pointer enters their corner or edge
+func (l *Listener) pollCorners() {
+	pointer, err := l.backend.Pointer()
+	if err != nil {
+		logger.L().WithError(err).Debug("can not query the pointer")
+		return
+	}
+
+	width, height := l.backend.ScreenSize()
+	z := zone(int(pointer.RootX), int(pointer.RootY), width, height)
+	if z == l.zone {
+		return
+	}
+	l.zone = z
+	if z == "" {
+		return
+	}
+
+	ev := Event{
+		Type:   parser.EvtHotCorner,
+		RootX:  pointer.RootX,
+		RootY:  pointer.RootY,
+		Child:  pointer.Child,
+		Window: pointer.Child,
+		Corner: z,
+	}
+	for _, c := range l.corners {
+		if c.corner == z && c.mods == pointer.Mods {
+			l.Exec(c.binding, ev)
+		}
+	}
+}
+
+// dragStart starts a drag if the pressed button has drag bindings
+func (l *Listener) dragStart(ev Event) {
+	bindings := l.bindings[grab{evtType: parser.EvtButtonDrag, key: ev.Key}]
+	if len(bindings) == 0 || l.drag != nil {
+		return
+	}
+
+	l.drag = &drag{
+		button:   ev.Key.Detail,
+		originX:  ev.RootX,
+		originY:  ev.RootY,
+		bindings: bindings,
+		last:     time.Now(),
+	}
+	l.dragRun(ev)
+}
+
+// dragMotion reports a motion of an ongoing drag, at most once per DragInterval
+func (l *Listener) dragMotion(ev Event) {
+	if l.drag == nil || ev.Key.Detail != l.drag.button {
+		return
+	}
+
+	// the release reports the final position anyway
+	if time.Since(l.drag.last) < DragInterval {
+		return
+	}
+	l.drag.last = time.Now()
+	l.dragRun(ev)
+}
+
+// dragEnd finishes an ongoing drag, reporting its final position
+func (l *Listener) dragEnd(ev Event) {
+	if l.drag == nil || ev.Key.Detail != l.drag.button {
+		return
+	}
+
+	l.dragRun(ev)
+	l.drag = nil
+}
+
+// dragRun runs every binding of the ongoing drag
+func (l *Listener) dragRun(ev Event) {
+	ev.DeltaX = ev.RootX - l.drag.originX
+	ev.DeltaY = ev.RootY - l.drag.originY
+	ev.Window = ev.Child
+	for _, b := range l.drag.bindings {
+		l.Exec(b, ev)
+	}
+}
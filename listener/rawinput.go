@@ -0,0 +1,148 @@
+package listener
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dakyskye/dxhd/logger"
+	"github.com/dakyskye/dxhd/parser"
+	"github.com/dakyskye/dxhd/xinput"
+)
+
+// xInput is a RawInput reading XInput2 raw events
+type xInput struct {
+	conn   *xinput.Conn
+	events chan RawEvent
+}
+
+// XInputDialer returns a raw dialer connecting to XInput2 of given display, an empty display means $DISPLAY
+func XInputDialer(display string) RawDialer {
+	return func() (RawInput, error) {
+		conn, err := xinput.Dial(display)
+		if err != nil {
+			return nil, err
+		}
+
+		in := &xInput{conn: conn, events: make(chan RawEvent)}
+		go in.read()
+
+		return in, nil
+	}
+}
+
+func (in *xInput) Events() <-chan RawEvent {
+	return in.events
+}
+
+func (in *xInput) Close() {
+	in.conn.Close()
+}
+
+// read translates xinput events into raw events
+func (in *xInput) read() {
+	defer close(in.events)
+
+	types := map[int]parser.EventType{
+		xinput.RawKeyPress:      parser.EvtKeyPress,
+		xinput.RawKeyRelease:    parser.EvtKeyRelease,
+		xinput.RawButtonPress:   parser.EvtButtonPress,
+		xinput.RawButtonRelease: parser.EvtButtonRelease,
+	}
+
+	for ev := range in.conn.Events() {
+		in.events <- RawEvent{
+			Type:   types[ev.Type],
+			Detail: byte(ev.Detail),
+			Device: ev.Device,
+			Time:   ev.Time,
+		}
+	}
+}
+
+// needsRawInput reports whether any binding is restricted to an input device
+func needsRawInput(data []parser.FileData) bool {
+	for _, d := range data {
+		if d.Device != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// listenDevice registers a binding restricted to an input device
+func (l *Listener) listenDevice(b Binding) error {
+	if l.raw == nil {
+		return fmt.Errorf("binding to device %q requires XInput 2", b.Device)
+	}
+	if b.EvtType == parser.EvtButtonDrag || b.EvtType == parser.EvtHotCorner {
+		return fmt.Errorf("%s bindings can not be restricted to a device", b.EvtType)
+	}
+
+	keys, err := l.backend.Keys(b.EvtType, b.Binding)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		g := grab{evtType: b.EvtType, key: key}
+		l.devices[g] = append(l.devices[g], b)
+	}
+
+	return nil
+}
+
+// bound reports whether a device binding is bound to the key or the button of a raw event, whatever its modifiers
+func (l *Listener) bound(raw RawEvent) bool {
+	for g := range l.devices {
+		if g.evtType == raw.Type && g.key.Detail == raw.Detail {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRaw runs the device bindings matching a raw event
+func (l *Listener) handleRaw(raw RawEvent) {
+	// every key typed is a raw event, the pointer is only queried for the ones bound
+	if !l.bound(raw) {
+		return
+	}
+
+	// raw events carry no modifier state, so it's queried
+	pointer, err := l.backend.Pointer()
+	if err != nil {
+		logger.L().WithError(err).Debug("can not query the pointer")
+		return
+	}
+
+	ev := Event{
+		Type:   raw.Type,
+		Key:    Key{Mods: pointer.Mods, Detail: raw.Detail},
+		Time:   raw.Time,
+		RootX:  pointer.RootX,
+		RootY:  pointer.RootY,
+		Child:  pointer.Child,
+		Device: raw.Device,
+	}
+
+	bindings := l.devices[grab{evtType: ev.Type, key: ev.Key}]
+
+	if l.record != nil && len(bindings) > 0 {
+		l.record(newRecord(l.backend.Name(), ev, bindings))
+	}
+
+	for _, b := range bindings {
+		if b.Device != raw.Device {
+			continue
+		}
+
+		ev.Window = ev.Child
+		if ev.Type == parser.EvtKeyPress || ev.Type == parser.EvtKeyRelease {
+			ev.Keysym = b.Binding[strings.LastIndex(b.Binding, "-")+1:]
+			if ev.Window, err = l.backend.FocusedWindow(); err != nil {
+				logger.L().WithError(err).Debug("can not get the focused window")
+			}
+		}
+		l.Exec(b, ev)
+	}
+}
@@ -0,0 +1,233 @@
+package listener
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// Record is a received event as written to a recording
+type Record struct {
+	Display string `json:"display"`
+	Time    uint32 `json:"time"`
+	Event   string `json:"event"`
+	// Detail is the keycode or the button number
+	Detail  byte     `json:"detail"`
+	State   uint16   `json:"state"`
+	Mods    uint16   `json:"mods"`
+	Keysym  string   `json:"keysym,omitempty"`
+	Device  string   `json:"device,omitempty"`
+	Matched []string `json:"matched"`
+}
+
+func newRecord(display string, ev Event, bindings []Binding) Record {
+	r := Record{
+		Display: display,
+		Time:    ev.Time,
+		Event:   ev.Type.String(),
+		Detail:  ev.Key.Detail,
+		State:   ev.State,
+		Mods:    ev.Key.Mods,
+		Keysym:  ev.Keysym,
+		Device:  ev.Device,
+		Matched: []string{},
+	}
+	for _, b := range bindings {
+		if b.Device == "" || b.Device == ev.Device {
+			r.Matched = append(r.Matched, b.Binding)
+		}
+	}
+	return r
+}
+
+// Recorder writes records to a writer, one JSON object per line
+type Recorder struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewRecorder returns a recorder writing to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Record writes a record, it's safe to be called from several listeners at once
+func (r *Recorder) Record(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.w.Write(append(data, '\n'))
+	return err
+}
+
+// modifier masks by their xgb names
+var modMasks = map[string]uint16{
+	"shift":   xproto.ModMaskShift,
+	"lock":    xproto.ModMaskLock,
+	"control": xproto.ModMaskControl,
+	"mod1":    xproto.ModMask1,
+	"mod2":    xproto.ModMask2,
+	"mod3":    xproto.ModMask3,
+	"mod4":    xproto.ModMask4,
+	"mod5":    xproto.ModMask5,
+}
+
+// keysymAliases are the keysyms of several names, KeysymToStr returns any one of them
+var keysymAliases = map[string]xproto.Keysym{
+	"apostrophe": 0x27, "quoteright": 0x27,
+	"grave": 0x60, "quoteleft": 0x60,
+	"Henkan": 0xff23, "Henkan_Mode": 0xff23,
+	"Prior": 0xff55, "Page_Up": 0xff55,
+	"Next": 0xff56, "Page_Down": 0xff56,
+	"Mode_switch": 0xff7e, "script_switch": 0xff7e, "ISO_Group_Shift": 0xff7e,
+	"KP_Prior": 0xff9a, "KP_Page_Up": 0xff9a,
+	"KP_Next": 0xff9b, "KP_Page_Down": 0xff9b,
+}
+
+var (
+	// keysyms are the keysyms of the latin 1, function and XF86 keys, by their names, lowercase names too, only replays
+	// need them so they are gathered the first time one does
+	keysyms     map[string]xproto.Keysym
+	keysymsOnce sync.Once
+)
+
+func keysymsByName() map[string]xproto.Keysym {
+	named := make(map[string]xproto.Keysym)
+	for name, keysym := range keysymAliases {
+		named[name] = keysym
+	}
+	// F11 to F35 are also named L1 to L10 and R1 to R15
+	for n := xproto.Keysym(1); n <= 35; n++ {
+		named[fmt.Sprintf("F%d", n)] = 0xffbd + n
+		if n > 10 && n <= 20 {
+			named[fmt.Sprintf("L%d", n-10)] = 0xffbd + n
+		} else if n > 20 {
+			named[fmt.Sprintf("R%d", n-20)] = 0xffbd + n
+		}
+	}
+	for _, r := range [][2]xproto.Keysym{{0x20, 0xff}, {0xfe00, 0xffff}, {0x1008ff00, 0x1008ffff}} {
+		for keysym := r[0]; keysym <= r[1]; keysym++ {
+			if name := keybind.KeysymToStr(keysym); name != "" {
+				named[name] = keysym
+			}
+		}
+	}
+
+	// exact names win over lowercase ones, a and A are different keysyms
+	byName := make(map[string]xproto.Keysym, len(named)*2)
+	for name, keysym := range named {
+		if lower := strings.ToLower(name); lower != name {
+			if _, ok := named[lower]; !ok {
+				byName[lower] = keysym
+			}
+		}
+	}
+	for name, keysym := range named {
+		byName[name] = keysym
+	}
+	return byName
+}
+
+// sameKey reports whether two key names name the same keysym, names which are not known are compared regardless
+// of their case
+func sameKey(a, b string) bool {
+	keysymsOnce.Do(func() { keysyms = keysymsByName() })
+	ka, okA := keysyms[a]
+	kb, okB := keysyms[b]
+	if okA && okB {
+		return ka == kb
+	}
+	return strings.EqualFold(a, b)
+}
+
+// matches reports whether a record would have triggered given binding (in xgb format),
+// keys are compared by the keysyms of their names since there is no keyboard mapping to work with
+func matches(rec Record, evtType parser.EventType, binding, device string) bool {
+	if rec.Event != evtType.String() {
+		return false
+	}
+	if device != "" && device != rec.Device {
+		return false
+	}
+
+	var (
+		mods uint16
+		key  string
+	)
+	for _, part := range strings.Split(binding, "-") {
+		if mask, ok := modMasks[strings.ToLower(part)]; ok {
+			mods |= mask
+		} else if key == "" {
+			key = part
+		}
+	}
+
+	if mods != rec.Mods {
+		return false
+	}
+	if evtType == parser.EvtButtonPress || evtType == parser.EvtButtonRelease {
+		return key == fmt.Sprint(rec.Detail)
+	}
+	return sameKey(key, rec.Keysym)
+}
+
+// Replay feeds a recording through the bindings of a config, without an X server,
+// and writes which commands would have run for each recorded event
+func Replay(r io.Reader, data []parser.FileData, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var rec Record
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return fmt.Errorf("can not read record on line %d (%s)", line, err.Error())
+		}
+
+		what := rec.Keysym
+		if what == "" {
+			what = fmt.Sprintf("button %d", rec.Detail)
+		}
+		if rec.Device != "" {
+			what += " of " + rec.Device
+		}
+		fmt.Fprintf(w, "%s %s (time %d, state %d, display %s)\n", rec.Event, what, rec.Time, rec.State, rec.Display)
+
+		ran := false
+		for _, d := range data {
+			if matches(rec, d.EvtType, d.Binding.String(), d.Device) {
+				fmt.Fprintln(w, "binding: "+d.OriginalBinding)
+				fmt.Fprintln(w, "command:")
+				fmt.Fprintln(w, d.Command.String())
+				ran = true
+			}
+		}
+		if !ran {
+			fmt.Fprintln(w, "no binding matched")
+		}
+		if len(rec.Matched) > 0 {
+			fmt.Fprintln(w, "matched when recorded: "+strings.Join(rec.Matched, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+
+	return scanner.Err()
+}
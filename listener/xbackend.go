@@ -0,0 +1,312 @@
+package listener
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/mousebind"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/dakyskye/dxhd/logger"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// xBackend is a Backend talking to an X server over xgb
+type xBackend struct {
+	X       *xgbutil.XUtil
+	display string
+	events  chan Event
+	// grabs counts how many event types share a grab, key press and release events share one and so do button events
+	grabs map[xGrab]int
+	mu    sync.Mutex
+	// closed is set once the connection is closed, xgb panics when closing it twice
+	closed int32
+}
+
+type xGrab struct {
+	button bool
+	key    Key
+}
+
+// XDialer returns a dialer connecting to given X display, an empty display means $DISPLAY
+func XDialer(display string) Dialer {
+	return func() (Backend, error) {
+		return NewXBackend(display)
+	}
+}
+
+// NewXBackend connects to given X display and starts reading its events
+func NewXBackend(display string) (Backend, error) {
+	X, err := xgbutil.NewConnDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+
+	keybind.Initialize(X)
+	mousebind.Initialize(X)
+
+	b := &xBackend{
+		X:       X,
+		display: display,
+		events:  make(chan Event),
+		grabs:   make(map[xGrab]int),
+	}
+
+	go b.read()
+
+	return b, nil
+}
+
+func (b *xBackend) Name() string {
+	if b.display == "" {
+		return "$DISPLAY"
+	}
+	return b.display
+}
+
+// isButton reports whether an event type is grabbed as a button
+func isButton(evtType parser.EventType) bool {
+	return evtType == parser.EvtButtonPress || evtType == parser.EvtButtonRelease || evtType == parser.EvtButtonDrag
+}
+
+func (b *xBackend) Keys(evtType parser.EventType, binding string) (keys []Key, err error) {
+	switch {
+	case evtType == parser.EvtKeyPress || evtType == parser.EvtKeyRelease:
+		var (
+			mods     uint16
+			keycodes []xproto.Keycode
+		)
+		mods, keycodes, err = keybind.ParseString(b.X, binding)
+		if err != nil {
+			return
+		}
+		for _, keycode := range keycodes {
+			keys = append(keys, Key{Mods: mods, Detail: byte(keycode)})
+		}
+	case isButton(evtType):
+		var (
+			mods   uint16
+			button xproto.Button
+		)
+		mods, button, err = mousebind.ParseString(b.X, binding)
+		if err != nil {
+			return
+		}
+		keys = append(keys, Key{Mods: mods, Detail: byte(button)})
+	default:
+		err = fmt.Errorf("wrong event type passed")
+	}
+
+	return
+}
+
+func (b *xBackend) Grab(evtType parser.EventType, binding string) (keys []Key, err error) {
+	keys, err = b.Keys(evtType, binding)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, key := range keys {
+		g := xGrab{button: isButton(evtType), key: key}
+		if b.grabs[g] == 0 {
+			if g.button {
+				err = mousebind.GrabChecked(b.X, b.X.RootWin(), key.Mods, xproto.Button(key.Detail), false)
+			} else {
+				err = keybind.GrabChecked(b.X, b.X.RootWin(), key.Mods, xproto.Keycode(key.Detail))
+			}
+			if err != nil {
+				// the keys of the binding grabbed so far are released, the binding is not registered
+				for _, grabbed := range keys[:i] {
+					_ = b.ungrab(xGrab{button: g.button, key: grabbed})
+				}
+				return nil, grabError(binding, err)
+			}
+		}
+		b.grabs[g]++
+	}
+
+	return
+}
+
+func (b *xBackend) Ungrab(evtType parser.EventType, key Key) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.ungrab(xGrab{button: isButton(evtType), key: key})
+}
+
+// ungrab releases a reference to a grab, and the grab itself once it was the last one, b.mu has to be held
+func (b *xBackend) ungrab(g xGrab) error {
+	if b.grabs[g] == 0 {
+		return fmt.Errorf("%v is not grabbed", g.key)
+	}
+	b.grabs[g]--
+	if b.grabs[g] > 0 {
+		return nil
+	}
+	delete(b.grabs, g)
+
+	if g.button {
+		mousebind.Ungrab(b.X, b.X.RootWin(), g.key.Mods, xproto.Button(g.key.Detail))
+	} else {
+		keybind.Ungrab(b.X, b.X.RootWin(), g.key.Mods, xproto.Keycode(g.key.Detail))
+	}
+	return nil
+}
+
+func (b *xBackend) Events() <-chan Event {
+	return b.events
+}
+
+func (b *xBackend) FocusedWindow() (uint32, error) {
+	reply, err := xproto.GetInputFocus(b.X.Conn()).Reply()
+	if err != nil {
+		return 0, err
+	}
+	return uint32(reply.Focus), nil
+}
+
+func (b *xBackend) Pointer() (Pointer, error) {
+	reply, err := xproto.QueryPointer(b.X.Conn(), b.X.RootWin()).Reply()
+	if err != nil {
+		return Pointer{}, err
+	}
+
+	mods := reply.Mask
+	for _, m := range xevent.IgnoreMods {
+		mods &= ^m
+	}
+
+	return Pointer{
+		RootX: reply.RootX,
+		RootY: reply.RootY,
+		Mods:  mods & 0xff,
+		Child: uint32(reply.Child),
+	}, nil
+}
+
+func (b *xBackend) ScreenSize() (width, height int) {
+	screen := b.X.Screen()
+	return int(screen.WidthInPixels), int(screen.HeightInPixels)
+}
+
+func (b *xBackend) Close() {
+	if atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		b.X.Conn().Close()
+	}
+}
+
+// read translates X events into backend events until the connection is closed
+func (b *xBackend) read() {
+	defer close(b.events)
+
+	for {
+		ev, xerr := b.X.Conn().WaitForEvent()
+		if ev == nil && xerr == nil {
+			// xgb closes the connection itself when it drops
+			atomic.StoreInt32(&b.closed, 1)
+			return
+		}
+		if xerr != nil {
+			logger.L().WithField("error", xerr.Error()).Debug("the X server reported an error")
+			continue
+		}
+
+		switch e := ev.(type) {
+		case xproto.KeyPressEvent:
+			b.events <- b.keyEvent(parser.EvtKeyPress, e.State, e.Detail, e.Time, e.RootX, e.RootY, e.Child)
+		case xproto.KeyReleaseEvent:
+			b.events <- b.keyEvent(parser.EvtKeyRelease, e.State, e.Detail, e.Time, e.RootX, e.RootY, e.Child)
+		case xproto.ButtonPressEvent:
+			b.events <- b.buttonEvent(parser.EvtButtonPress, e.State, e.Detail, e.Time, e.RootX, e.RootY, e.Child)
+		case xproto.ButtonReleaseEvent:
+			b.events <- b.buttonEvent(parser.EvtButtonRelease, e.State, e.Detail, e.Time, e.RootX, e.RootY, e.Child)
+		case xproto.MotionNotifyEvent:
+			// motion is only reported whilst a grabbed button is held
+			if button := heldButton(e.State); button != 0 {
+				b.events <- b.buttonEvent(parser.EvtButtonDrag, e.State, button, e.Time, e.RootX, e.RootY, e.Child)
+			}
+		case xproto.MappingNotifyEvent:
+			if !b.updateMaps() {
+				continue
+			}
+			// keys are grabbed by keycode, which a new keyboard mapping may move keysyms to
+			if e.Request == xproto.MappingKeyboard {
+				b.events <- Event{Remapped: true}
+			}
+		}
+	}
+}
+
+// updateMaps refreshes the keyboard and modifier maps keys are looked up in, after setxkbmap or a keyboard hotplug
+func (b *xBackend) updateMaps() (ok bool) {
+	// xgbutil panics when the server does not reply, which only happens when the connection drops
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().WithField("error", r).Debug("can not get the keyboard mapping")
+		}
+	}()
+
+	keyMap, modMap := keybind.MapsGet(b.X)
+	keybind.KeyMapSet(b.X, keyMap)
+	keybind.ModMapSet(b.X, modMap)
+	return true
+}
+
+func (b *xBackend) keyEvent(evtType parser.EventType, state uint16, detail xproto.Keycode, time xproto.Timestamp, rootX, rootY int16, child xproto.Window) Event {
+	mods, keycode := keybind.DeduceKeyInfo(state, detail)
+	return Event{
+		Type:   evtType,
+		Key:    Key{Mods: mods, Detail: byte(keycode)},
+		State:  state,
+		Keysym: keybind.KeysymToStr(keybind.KeysymGet(b.X, keycode, 0)),
+		Time:   uint32(time),
+		RootX:  rootX,
+		RootY:  rootY,
+		Child:  uint32(child),
+	}
+}
+
+func (b *xBackend) buttonEvent(evtType parser.EventType, state uint16, detail xproto.Button, time xproto.Timestamp, rootX, rootY int16, child xproto.Window) Event {
+	mods, button := mousebind.DeduceButtonInfo(state, detail)
+	return Event{
+		Type:  evtType,
+		Key:   Key{Mods: mods, Detail: byte(button)},
+		State: state,
+		Time:  uint32(time),
+		RootX: rootX,
+		RootY: rootY,
+		Child: uint32(child),
+	}
+}
+
+// heldButton returns the lowest button held down in a modifier state, 0 if none is
+func heldButton(state uint16) xproto.Button {
+	masks := []uint16{
+		xproto.ButtonMask1,
+		xproto.ButtonMask2,
+		xproto.ButtonMask3,
+		xproto.ButtonMask4,
+		xproto.ButtonMask5,
+	}
+	for i, mask := range masks {
+		if state&mask != 0 {
+			return xproto.Button(i + 1)
+		}
+	}
+	return 0
+}
+
+// grabError makes grab errors a bit more user friendly
+func grabError(binding string, err error) error {
+	if _, ok := err.(xproto.AccessError); ok {
+		return fmt.Errorf("%s is already grabbed by another client", binding)
+	}
+	return fmt.Errorf("can not grab %s (%s)", binding, err.Error())
+}
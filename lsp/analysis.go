@@ -0,0 +1,159 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// source names dxhd as the source of diagnostics
+const source = "dxhd"
+
+// includePattern matches a shell line sourcing another file
+var includePattern = regexp.MustCompile(`^\s*(?:source|\.)\s+("[^"]*"|'[^']*'|\S+)`)
+
+// sortedKeys are the names of the keys completed, in alphabetical order
+var sortedKeys = sortedKeyNames()
+
+// diagnostics reports the bindings dxhd can not register, the ones registered twice and the lines no binding runs
+func diagnostics(d *document) (diags []Diagnostic) {
+	add := func(n *parser.Node, severity int, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{Range: d.span(n.Start, n.End), Severity: severity, Source: source, Message: fmt.Sprintf(format, args...)})
+	}
+
+	blocks := d.tree.Blocks
+	if len(blocks) == 0 {
+		diags = append(diags, Diagnostic{Severity: SeverityError, Source: source, Message: "config file does not contain any binding"})
+		return
+	}
+
+	for i := range d.tree.Nodes {
+		n := &d.tree.Nodes[i]
+		if n.Kind != parser.NodeCommand || n.Start > blocks[0].Binding.Start {
+			continue
+		}
+		add(n, SeverityWarning, "the command belongs to no binding, it is not run")
+	}
+
+	// the line each binding is first bound on, by its device, event and keys
+	bound := make(map[string]int)
+	for i, block := range blocks {
+		if len(block.Body.Lines) == 0 {
+			if i+1 < len(blocks) {
+				add(block.Binding, SeverityWarning, "the binding has no command, it is overwritten by the one on line %d", blocks[i+1].Binding.Line)
+				continue
+			}
+			add(block.Binding, SeverityWarning, "the binding has no command")
+		}
+
+		data, err := block.Expand()
+		if err != nil {
+			add(block.Binding, SeverityError, "can't register the keybinding, %s", err.Error())
+			continue
+		}
+		for _, b := range data {
+			key := fmt.Sprintf("%s\x00%s\x00%s", b.Device, b.EvtType, normalize(b.Binding.String()))
+			if line, ok := bound[key]; ok {
+				add(block.Binding, SeverityWarning, "%s is already bound on line %d", parser.Pretty(b.OriginalBinding), line)
+				continue
+			}
+			bound[key] = b.Line
+		}
+	}
+	return
+}
+
+// normalize sorts the keys of a translated binding, keys are looked up regardless of their case
+func normalize(translated string) string {
+	keys := strings.Split(strings.ToLower(translated), "-")
+	sort.Strings(keys)
+	return strings.Join(keys, "-")
+}
+
+// hover shows every binding a binding line expands to
+func hover(d *document, pos Position) *Hover {
+	n, _ := d.node(pos)
+	if n == nil || n.Kind != parser.NodeBinding {
+		return nil
+	}
+	block := d.block(n)
+	data, err := block.Expand()
+	if err != nil {
+		return nil
+	}
+
+	var b strings.Builder
+	if len(data) > 1 {
+		fmt.Fprintf(&b, "expands to %d bindings\n\n", len(data))
+	}
+	b.WriteString("```\n")
+	for _, line := range parser.Lines(data) {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("```")
+
+	r := d.span(n.Start, n.End)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: b.String()}, Range: &r}
+}
+
+// completion suggests the modifiers and the keys starting with the word being written on a binding line
+func completion(d *document, pos Position) (items []CompletionItem) {
+	n, offset := d.node(pos)
+	if n == nil || n.Kind == parser.NodeShebang || !strings.HasPrefix(n.Text, "#") || strings.HasPrefix(n.Text, "##") {
+		return
+	}
+	before := d.src[n.Start:offset]
+	// inside the name of a device
+	if strings.Count(before, `"`)%2 == 1 {
+		return
+	}
+	word := strings.ToLower(before[strings.LastIndexFunc(before, func(r rune) bool {
+		return !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})+1:])
+
+	for _, mod := range modifiers {
+		if strings.HasPrefix(mod, word) {
+			items = append(items, CompletionItem{Label: mod, Kind: kindKeyword, Detail: "modifier", SortText: "0" + mod})
+		}
+	}
+	for _, key := range sortedKeys {
+		if strings.HasPrefix(strings.ToLower(key), word) {
+			items = append(items, CompletionItem{Label: key, Kind: kindConstant, Detail: keyNames[key], SortText: "1" + key})
+		}
+	}
+	return
+}
+
+// definition returns the file a line sources, relative paths are relative to the config
+func definition(d *document, pos Position) *Location {
+	n, _ := d.node(pos)
+	if n == nil || n.Kind != parser.NodeGlobal && n.Kind != parser.NodeCommand {
+		return nil
+	}
+	m := includePattern.FindStringSubmatch(n.Text)
+	if m == nil {
+		return nil
+	}
+
+	path := strings.Trim(m[1], `"'`)
+	if strings.HasPrefix(path, "~/") {
+		path = "$HOME" + path[1:]
+	}
+	path = os.ExpandEnv(path)
+	if !filepath.IsAbs(path) {
+		config := d.path()
+		if config == "" {
+			return nil
+		}
+		path = filepath.Join(filepath.Dir(config), path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	return &Location{URI: fileURI(path)}
+}
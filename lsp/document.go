@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// document is a config open in an editor
+type document struct {
+	uri  string
+	src  string
+	tree *parser.Tree
+}
+
+func newDocument(uri, src string) *document {
+	return &document{uri: uri, src: src, tree: parser.ParseTree([]byte(src))}
+}
+
+// path returns the path of the config, empty if it's not a file
+func (d *document) path() string {
+	u, err := url.Parse(d.uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// position returns the position of a byte offset
+func (d *document) position(offset int) Position {
+	nodes := d.tree.Nodes
+	line := sort.Search(len(nodes), func(i int) bool { return nodes[i].End >= offset })
+	if line == len(nodes) {
+		// the end of a config ending with a line break
+		return Position{Line: line}
+	}
+	return Position{Line: line, Character: utf16Len(d.src[nodes[line].Start:offset])}
+}
+
+// span returns the range of the text between two byte offsets
+func (d *document) span(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// node returns the line at a position and the byte offset of the position, nil if there is no such line
+func (d *document) node(pos Position) (n *parser.Node, offset int) {
+	if pos.Line < 0 || pos.Line >= len(d.tree.Nodes) {
+		return
+	}
+	n = &d.tree.Nodes[pos.Line]
+	offset = n.Start
+	for units := 0; offset < n.End; {
+		r, size := utf8.DecodeRuneInString(d.src[offset:n.End])
+		units += utf16Units(r)
+		if units > pos.Character {
+			break
+		}
+		offset += size
+	}
+	return
+}
+
+// block returns the block a binding line belongs to
+func (d *document) block(n *parser.Node) *parser.Block {
+	for _, b := range d.tree.Blocks {
+		if b.Binding == n {
+			return b
+		}
+	}
+	return nil
+}
+
+func utf16Units(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func utf16Len(s string) (n int) {
+	for _, r := range s {
+		n += utf16Units(r)
+	}
+	return
+}
+
+// fileURI returns the URI of a file
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,58 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"unicode"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/dakyskye/dxhd/parser"
+)
+
+// modifiers are the modifiers of bindings, in the order bindings are formatted with
+var modifiers = []string{"super", "ctrl", "alt", "shift", "mod3", "mod5"}
+
+// keysymRanges are the keysyms key names are looked up for, latin 1, function keys and XF86 keys
+var keysymRanges = [][2]xproto.Keysym{{0x20, 0x7e}, {0xa0, 0xff}, {0xfe00, 0xffff}, {0x1008ff00, 0x1008ffff}}
+
+// keyNames are the keys completed, by their names
+var keyNames = names()
+
+func names() map[string]string {
+	keys := make(map[string]string)
+	for _, r := range keysymRanges {
+		for keysym := r[0]; keysym <= r[1]; keysym++ {
+			name := keybind.KeysymToStr(keysym)
+			// punctuation is looked up by its name, like braceleft, not by itself, letters by their lowercase
+			if runes := []rune(name); name == "" || len(runes) == 1 && !unicode.IsLower(runes[0]) && !unicode.IsDigit(runes[0]) {
+				continue
+			}
+			keys[name] = "key"
+		}
+	}
+	// keysyms of several names have one of them looked up
+	for _, name := range []string{"Prior", "Next", "Page_Up", "Page_Down"} {
+		keys[name] = "key"
+	}
+	for button := 1; button <= 9; button++ {
+		keys[fmt.Sprintf("mouse%d", button)] = "button"
+		keys[fmt.Sprintf("mouse%ddrag", button)] = "drag"
+	}
+	for _, wheel := range []string{"wheelup", "wheeldown", "wheelleft", "wheelright"} {
+		keys[wheel] = "wheel"
+	}
+	for _, corner := range parser.HotCorners {
+		keys[corner] = "hot corner"
+	}
+	return keys
+}
+
+// sortedKeyNames returns the names of the keys in alphabetical order
+func sortedKeyNames() (names []string) {
+	for name := range keyNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
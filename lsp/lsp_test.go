@@ -0,0 +1,171 @@
+package lsp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/lsp"
+)
+
+const config = `#!/bin/sh
+. ./aliases.sh
+## workspace {1-3}
+# super + {1-3}
+i3-msg workspace {1-3}
+
+# super + 2
+echo again
+# super + shi
+echo typing
+# super + {a,b}
+echo {a,b,c}
+`
+
+// client speaks to a server the way an editor does
+type client struct {
+	t   *testing.T
+	in  io.WriteCloser
+	out *bufio.Reader
+	id  int
+}
+
+func (c *client) send(method string, params interface{}, request bool) {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if request {
+		c.id++
+		msg["id"] = c.id
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err = fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) receive(v interface{}) {
+	c.t.Helper()
+	headers, err := textproto.NewReader(c.out).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	length, _ := strconv.Atoi(headers.Get("Content-Length"))
+	body := make([]byte, length)
+	if _, err = io.ReadFull(c.out, body); err != nil {
+		c.t.Fatal(err)
+	}
+	if err = json.Unmarshal(body, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// request sends a request about a position of the config and decodes the result of its response
+func (c *client) request(method, uri string, line, character int, result interface{}) {
+	c.t.Helper()
+	c.send(method, map[string]interface{}{
+		"textDocument": map[string]string{"uri": uri},
+		"position":     map[string]int{"line": line, "character": character},
+	}, true)
+	var response struct {
+		ID     int
+		Result json.RawMessage
+	}
+	c.receive(&response)
+	if response.ID != c.id {
+		c.t.Fatalf("expected the response to %d, got %d", c.id, response.ID)
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "aliases.sh"), []byte("alias ws=i3-msg\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := "file://" + filepath.Join(dir, "dxhd.sh")
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- lsp.Serve(inReader, outWriter, "test")
+	}()
+	c := &client{t: t, in: inWriter, out: bufio.NewReader(outReader)}
+
+	c.send("initialize", map[string]interface{}{}, true)
+	var initialized struct {
+		Result struct {
+			Capabilities map[string]interface{}
+		}
+	}
+	c.receive(&initialized)
+	if initialized.Result.Capabilities["hoverProvider"] != true {
+		t.Fatalf("unexpected capabilities %v", initialized.Result.Capabilities)
+	}
+	c.send("initialized", map[string]interface{}{}, false)
+
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "sh", "version": 1, "text": config},
+	}, false)
+	var published struct {
+		Method string
+		Params struct {
+			Diagnostics []lsp.Diagnostic
+		}
+	}
+	c.receive(&published)
+	diags := published.Params.Diagnostics
+	if published.Method != "textDocument/publishDiagnostics" || len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", published)
+	}
+	if diags[0].Severity != lsp.SeverityWarning || diags[0].Range.Start.Line != 6 || diags[0].Message != "super + 2 is already bound on line 4" {
+		t.Errorf("unexpected duplicate warning %+v", diags[0])
+	}
+	if diags[1].Severity != lsp.SeverityError || diags[1].Range.Start.Line != 10 || !strings.Contains(diags[1].Message, "do not match") {
+		t.Errorf("unexpected error %+v", diags[1])
+	}
+
+	var hover lsp.Hover
+	c.request("textDocument/hover", uri, 3, 4, &hover)
+	want := "expands to 3 bindings\n\n```\nsuper + 1  workspace 1\nsuper + 2  workspace 2\nsuper + 3  workspace 3\n```"
+	if hover.Contents.Value != want {
+		t.Errorf("expected hover %q, got %q", want, hover.Contents.Value)
+	}
+
+	var items []lsp.CompletionItem
+	c.request("textDocument/completion", uri, 8, 13, &items)
+	if len(items) == 0 || items[0].Label != "shift" || items[0].Detail != "modifier" {
+		t.Fatalf("expected shift to be completed first, got %+v", items)
+	}
+	for _, item := range items {
+		if !strings.HasPrefix(strings.ToLower(item.Label), "shi") {
+			t.Errorf("unexpected completion %q", item.Label)
+		}
+	}
+
+	var location lsp.Location
+	c.request("textDocument/definition", uri, 1, 0, &location)
+	if location.URI != "file://"+filepath.Join(dir, "aliases.sh") {
+		t.Errorf("expected the definition in aliases.sh, got %+v", location)
+	}
+
+	c.send("shutdown", nil, true)
+	var shutdown map[string]interface{}
+	c.receive(&shutdown)
+	c.send("exit", nil, false)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
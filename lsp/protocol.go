@@ -0,0 +1,150 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// message is a JSON-RPC request or notification read, requests have an id
+type message struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// error codes of JSON-RPC and LSP
+const (
+	codeParseError     = -32700
+	codeInvalidParams  = -32602
+	codeMethodNotFound = -32601
+	codeNotInitialized = -32002
+)
+
+// read reads the body of a message framed by its headers
+func read(r *bufio.Reader) (body []byte, err error) {
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		err = fmt.Errorf("invalid content length %q", headers.Get("Content-Length"))
+		return
+	}
+	body = make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return
+}
+
+// write writes a message framed by its headers, fields are the ones of the message but its version
+func write(w io.Writer, fields map[string]interface{}) (err error) {
+	fields["jsonrpc"] = "2.0"
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return
+}
+
+// Position is a zero based line and a character offset in UTF-16 code units
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a range of a document, its end is exclusive
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range of a document
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// diagnostic severities
+const (
+	SeverityError   = 1
+	SeverityWarning = 2
+)
+
+// Diagnostic is a problem of a config
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// completion item kinds
+const (
+	kindKeyword  = 14
+	kindConstant = 21
+)
+
+// CompletionItem is a key or modifier suggested
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+	// SortText puts modifiers before keys
+	SortText string `json:"sortText,omitempty"`
+}
+
+// Hover is the expansions of a binding
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// MarkupContent is markdown or plain text shown by an editor
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type textDocumentItem struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type positionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
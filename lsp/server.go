@@ -0,0 +1,185 @@
+// Package lsp is a language server of dxhd configs, speaking the language server protocol over stdio
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/dakyskye/dxhd/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// server holds the configs open in an editor
+type server struct {
+	version     string
+	out         io.Writer
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+// requests are the requests served, by their methods
+var requests = map[string]func(s *server, params json.RawMessage) (interface{}, error){
+	"initialize": func(s *server, _ json.RawMessage) (interface{}, error) {
+		s.initialized = true
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// the whole text is sent on every change
+				"textDocumentSync":   1,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{"+", " "}},
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "dxhd", "version": s.version},
+		}, nil
+	},
+	"shutdown": func(s *server, _ json.RawMessage) (interface{}, error) {
+		s.shutdown = true
+		return nil, nil
+	},
+	"textDocument/hover": func(s *server, params json.RawMessage) (interface{}, error) {
+		return withPosition(s, params, func(d *document, pos Position) interface{} {
+			if h := hover(d, pos); h != nil {
+				return h
+			}
+			return nil
+		})
+	},
+	"textDocument/completion": func(s *server, params json.RawMessage) (interface{}, error) {
+		return withPosition(s, params, func(d *document, pos Position) interface{} {
+			return completion(d, pos)
+		})
+	},
+	"textDocument/definition": func(s *server, params json.RawMessage) (interface{}, error) {
+		return withPosition(s, params, func(d *document, pos Position) interface{} {
+			if l := definition(d, pos); l != nil {
+				return l
+			}
+			return nil
+		})
+	},
+}
+
+// notifications are the notifications handled, by their methods
+var notifications = map[string]func(s *server, params json.RawMessage) error{
+	"textDocument/didOpen": func(s *server, params json.RawMessage) (err error) {
+		var p didOpenParams
+		if err = json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		return s.open(p.TextDocument.URI, p.TextDocument.Text)
+	},
+	"textDocument/didChange": func(s *server, params json.RawMessage) (err error) {
+		var p didChangeParams
+		if err = json.Unmarshal(params, &p); err != nil || len(p.ContentChanges) == 0 {
+			return
+		}
+		return s.open(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	},
+	"textDocument/didClose": func(s *server, params json.RawMessage) (err error) {
+		var p didCloseParams
+		if err = json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}})
+	},
+}
+
+// withPosition runs f on the document and the position a request is about, null if the document is not open
+func withPosition(s *server, params json.RawMessage, f func(d *document, pos Position) interface{}) (result interface{}, err error) {
+	var p positionParams
+	if err = json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	if d, ok := s.docs[p.TextDocument.URI]; ok {
+		result = f(d, p.Position)
+	}
+	return
+}
+
+// Serve speaks the language server protocol over r and w until the editor exits or closes r
+func Serve(r io.Reader, w io.Writer, version string) (err error) {
+	s := &server{version: version, out: w, docs: make(map[string]*document)}
+	in := bufio.NewReader(r)
+	for {
+		var body []byte
+		body, err = read(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return
+		}
+
+		var msg message
+		if e := json.Unmarshal(body, &msg); e != nil {
+			err = s.respondError(nil, codeParseError, e.Error())
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				err = errors.New("the editor exited without shutting dxhd down")
+			}
+			return
+		}
+
+		err = s.handle(msg)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handle serves a request or handles a notification, errors are the ones of writing to the editor
+func (s *server) handle(msg message) (err error) {
+	if msg.ID == nil {
+		notification, ok := notifications[msg.Method]
+		if !ok || !s.initialized {
+			return
+		}
+		if e := notification(s, msg.Params); e != nil {
+			logger.L().WithError(e).WithField("method", msg.Method).Warn("can not handle a notification")
+		}
+		return
+	}
+
+	request, ok := requests[msg.Method]
+	switch {
+	case !ok:
+		return s.respondError(msg.ID, codeMethodNotFound, "method not found: "+msg.Method)
+	case !s.initialized && msg.Method != "initialize":
+		return s.respondError(msg.ID, codeNotInitialized, "the server is not initialized")
+	}
+	result, e := request(s, msg.Params)
+	if e != nil {
+		logger.L().WithFields(logrus.Fields{"method": msg.Method, "error": e}).Debug("invalid request")
+		return s.respondError(msg.ID, codeInvalidParams, e.Error())
+	}
+	return write(s.out, map[string]interface{}{"id": msg.ID, "result": result})
+}
+
+// open stores the text of a document and publishes its diagnostics
+func (s *server) open(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	diags := diagnostics(d)
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: uri, Diagnostics: diags})
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	return write(s.out, map[string]interface{}{"method": method, "params": params})
+}
+
+func (s *server) respondError(id *json.RawMessage, code int, message string) error {
+	return write(s.out, map[string]interface{}{"id": id, "error": responseError{Code: code, Message: message}})
+}
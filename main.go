@@ -59,50 +59,27 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/BurntSushi/xgbutil"
-	"github.com/BurntSushi/xgbutil/keybind"
-	"github.com/BurntSushi/xgbutil/mousebind"
-	"github.com/BurntSushi/xgbutil/xevent"
 	"github.com/dakyskye/dxhd/config"
+	"github.com/dakyskye/dxhd/daemon"
+	"github.com/dakyskye/dxhd/export"
+	"github.com/dakyskye/dxhd/history"
+	"github.com/dakyskye/dxhd/instance"
 	"github.com/dakyskye/dxhd/listener"
 	"github.com/dakyskye/dxhd/logger"
+	"github.com/dakyskye/dxhd/lsp"
+	"github.com/dakyskye/dxhd/notify"
 	"github.com/dakyskye/dxhd/options"
 	"github.com/dakyskye/dxhd/parser"
+	"github.com/dakyskye/dxhd/sxhkd"
+	"github.com/dakyskye/dxhd/systemd"
 	"github.com/sirupsen/logrus"
 )
 
-var usage = `NAME
-  dxhd - daky's X11 Hotkey Daemon
-VERSION
-  %s
-SYNOPSIS
-  dxhd [OPTIONS]
-DESCRIPTION
-  dxhd is an easy-to-use X11 hotkey daemon, written in Go programming language, and inspired by sxhkd.
-  More can be read here - https://github.com/dakyskye/dxhd#readme
-OPTIONS%s
-EXAMPLE CONFIG
-  #!/usr/bin/bash
-  ## restart i3
-  # super + shift + r
-  i3-msg -t command restart
-  ## switch to workspace 1-10
-  # super + @{1-9,0}
-  i3-msg -t command workspace {1-9,10}
-  ## switch to workspace 11-20
-  # super + ctrl + {1-9,0}
-  i3-msg -t command workspace {11-19,20}
-  ## switch to next/prev workspace
-  # super + @mouse{4,5}
-  i3-msg -t command workspace {next,prev}
-BUGS
-  report a bug here if you find one - https://github.com/dakyskye/dxhd/issues
-AUTHOR
-  Lasha Kanteladze <kanteladzelasha339@gmail.com>`
-
 var version = `master`
 
 func main() {
@@ -110,13 +87,36 @@ func main() {
 		logger.L().Fatalln("dxhd is only supported on linux")
 	}
 
+	// a daemon started by --background reports fatal errors to the process which started it
+	detached := daemon.Detach()
+	if detached {
+		logger.L().AddHook(daemon.Hook{})
+	}
+
+	opts, err := options.Parse()
+	if err != nil {
+		logger.L().Fatalln(err)
+	}
+	if detached {
+		opts.Background = false
+	}
+	for _, name := range opts.Ignored {
+		logger.L().WithField("option", "--"+name).WithField("command", opts.Command).Warn("the option does nothing for the command, ignoring it")
+	}
+
+	if opts.Command == "fmt" && len(opts.Args) > 0 {
+		opts.Config = &opts.Args[0]
+	}
+
 	stdin := new([]byte)
 
 	stat, err := os.Stdin.Stat()
 	if err != nil {
 		logger.L().WithError(err).Fatal("can not stat stdin")
 	}
-	if stat.Mode()&os.ModeCharDevice == 0 {
+	// the config is read from stdin by the commands reading one, unless they were given a file
+	readsConfig := map[string]bool{"run": true, "check": true, "list": true, "export": true, "fmt": true}
+	if stat.Mode()&os.ModeCharDevice == 0 && readsConfig[opts.Command] && opts.Config == nil {
 		*stdin, err = ioutil.ReadAll(os.Stdin)
 		if err != nil {
 			logger.L().WithError(err).Fatal("can not read the stdin")
@@ -125,53 +125,23 @@ func main() {
 		stdin = nil
 	}
 
-	opts, err := options.Parse()
-	if err != nil {
-		logger.L().Fatalln(err)
-	}
-
-	usage = fmt.Sprintf(usage, version, options.OptionsToPrint)
-
-	exit := false
-
-	if opts.Help {
-		fmt.Println(usage)
+	if opts.Help || opts.Command == "help" {
+		name := opts.Command
+		if name == "help" && len(opts.Args) > 0 {
+			name = opts.Args[0]
+		}
+		if cmd := options.FindCommand(name); cmd != nil && name != "help" && name != options.DefaultCommand {
+			fmt.Println(options.CommandUsage(cmd))
+		} else if cmd == nil {
+			logger.L().Fatalf("%s is not a command", name)
+		} else {
+			fmt.Println(options.Usage(version))
+		}
 		fmt.Println()
-		exit = true
-	} else if opts.Version {
+		os.Exit(0)
+	} else if opts.Version || opts.Command == "version" {
 		fmt.Println("you are using dxhd, version " + version)
 		fmt.Println()
-		exit = true
-	}
-
-	runInBackground := func(data *[]byte) (err error) {
-		exc, err := os.Executable()
-		if err != nil {
-			logger.L().WithError(err).Fatal("can not get the executable")
-		}
-		cmd := exec.Command(exc, os.Args...)
-		if data != nil {
-			cmd.Stdin = bytes.NewReader(*data)
-		}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Foreground: false,
-			Setsid:     true,
-		}
-		err = cmd.Start()
-		if err != nil {
-			logger.L().WithError(err).Fatal("can not run dxhd in the background")
-		}
-		time.Sleep(time.Microsecond * 10)
-		return
-	}
-
-	if opts.Background && !opts.Interactive {
-		err = runInBackground(stdin)
-		if err != nil {
-			logger.L().WithError(err).Fatal("can not run dxhd in the background")
-		}
 		os.Exit(0)
 	}
 
@@ -190,16 +160,80 @@ func main() {
 		return
 	}
 
-	if opts.Edit != nil {
+	// commands which don't read the config
+	switch opts.Command {
+	case "completion":
+		err = options.Completion(os.Stdout, opts.Args[0])
+		if err != nil {
+			logger.L().Fatalln(err)
+		}
+		os.Exit(0)
+	case "import":
+		if opts.Args[0] != "sxhkd" {
+			logger.L().Fatalf("can not import %s configs, only sxhkd ones", opts.Args[0])
+		}
+		file, err := os.Open(opts.Args[1])
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not open the sxhkd config")
+		}
+		config, unsupported, err := sxhkd.Convert(file)
+		_ = file.Close()
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not read the sxhkd config")
+		}
+		for _, u := range unsupported {
+			logger.L().WithField("line", u.Line).Warn(u.Reason)
+		}
+		fmt.Print(config)
+		os.Exit(0)
+	case "lsp":
+		err = lsp.Serve(os.Stdin, os.Stdout, version)
+		if err != nil {
+			logger.L().WithError(err).Fatal("the language server failed")
+		}
+		os.Exit(0)
+	case "man":
+		err = options.Manual(os.Stdout, version)
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not write the man page")
+		}
+		os.Exit(0)
+	case "keys":
+		display := ""
+		if len(opts.Displays) > 0 {
+			display = opts.Displays[0]
+		}
+		err = listener.InspectKeys(display, os.Stdout)
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not inspect keys")
+		}
+		os.Exit(0)
+	case "history":
+		dir, err := config.GetStateDir()
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not get the state directory")
+		}
+		binding := ""
+		if len(opts.Args) > 0 {
+			binding = opts.Args[0]
+		}
+		entries, err := history.Read(dir, binding)
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not read the history")
+		}
+		history.Print(os.Stdout, entries)
+		os.Exit(0)
+	case "edit":
 		editor, err := findEditor()
 		if err != nil {
 			logger.L().WithError(err).Fatal("can not find a suitable editor to use")
 		}
 		_, configDir, _ := config.GetDefaultConfigPath()
-		if *opts.Edit == "" {
-			*opts.Edit = "dxhd.sh"
+		file := "dxhd.sh"
+		if len(opts.Args) > 0 && opts.Args[0] != "" {
+			file = opts.Args[0]
 		}
-		path := filepath.Join(configDir, *opts.Edit)
+		path := filepath.Join(configDir, file)
 		cmd := exec.Command(editor, path)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -208,7 +242,80 @@ func main() {
 		if err != nil {
 			logger.L().WithError(err).WithFields(logrus.Fields{"editor": editor, "path": path}).Fatal("cannot invoke editor")
 		}
-		exit = true
+		os.Exit(0)
+	case "kill", "reload":
+		kill := opts.Command == "kill"
+
+		if len(opts.Args) > 0 {
+			target := opts.Args[0]
+			if kill {
+				err = instance.Signal(target, syscall.SIGINT)
+			} else {
+				err = instance.Signal(target, syscall.SIGUSR1)
+			}
+
+			if err != nil {
+				if kill {
+					logger.L().WithError(err).WithField("instance", target).Fatal("can not kill the dxhd instance")
+				} else {
+					logger.L().WithError(err).WithField("instance", target).Fatal("can not reload the dxhd instance")
+				}
+			}
+
+			if kill {
+				fmt.Printf("killing the %s instance of dxhd\n", target)
+			} else {
+				fmt.Printf("reloading the %s instance of dxhd\n", target)
+			}
+			os.Exit(0)
+		}
+
+		// the instances are told apart by their locks, other processes named dxhd are left alone
+		names, err := instance.List()
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not list the running instances of dxhd")
+		}
+		sig := syscall.SIGUSR1
+		if kill {
+			sig = syscall.SIGINT
+		}
+		for _, name := range names {
+			if err = instance.Signal(name, sig); err != nil {
+				logger.L().WithError(err).WithField("instance", name).Warn("can not signal the dxhd instance")
+			}
+		}
+
+		if kill {
+			fmt.Println("killing every running instances of dxhd")
+		} else {
+			fmt.Println("reloading every running instances of dxhd")
+		}
+		os.Exit(0)
+	}
+
+	runInBackground := func(data *[]byte) {
+		var stdin []byte
+		if data != nil {
+			stdin = *data
+		}
+		logFile := ""
+		if opts.LogFile != nil {
+			logFile = *opts.LogFile
+		}
+
+		pid, msg, err := daemon.Start(stdin, logFile)
+		if err == daemon.ErrNotReady {
+			fmt.Printf("dxhd is running in the background with pid %d, but has not registered its bindings yet\n", pid)
+			os.Exit(0)
+		} else if err != nil {
+			logger.L().WithError(err).Fatal("can not run dxhd in the background")
+		}
+		fmt.Printf("dxhd is running in the background with pid %d, %s\n", pid, msg)
+		os.Exit(0)
+	}
+
+	if opts.Background && !opts.Interactive {
+		runInBackground(stdin)
 	}
 
 	var (
@@ -253,11 +360,7 @@ func main() {
 			}
 
 			if opts.Background {
-				err = runInBackground(stdin)
-				if err != nil {
-					logger.L().WithError(err).Fatal("can not run dxhd in the background")
-				}
-				os.Exit(0)
+				runInBackground(stdin)
 			}
 		} else if opts.Config != nil {
 			if validPath, err = config.IsPathToConfigValid(*opts.Config); !(err == nil && validPath) {
@@ -288,6 +391,10 @@ func main() {
 		}
 	}
 
+	if opts.Command == "fmt" {
+		formatConfig(configFilePath, stdin, opts.Check)
+	}
+
 	var (
 		data      []parser.FileData
 		shell     string
@@ -318,63 +425,177 @@ func main() {
 		)
 		fmt.Printf("it took %s to parse the config\n", timeTaken)
 		fmt.Printf("%d parsed keybindins (including replicated variants and ranges)\n", len(data))
-		exit = true
 	}
 
-	if opts.DryRun {
-		fmt.Println("dxhd dry run")
-		for _, d := range data {
-			fmt.Println("binding: " + d.OriginalBinding)
-			fmt.Println("command:")
-			fmt.Println(d.Command.String())
+	// commands which only read the config
+	switch opts.Command {
+	case "check":
+		if !opts.ParseTime {
+			fmt.Printf("the config is valid, %d keybindings (including replicated variants and ranges)\n", len(data))
 		}
-		fmt.Println()
-		exit = true
-	}
-
-	if opts.Kill || opts.Reload {
-		execName, err := os.Executable()
+		os.Exit(0)
+	case "list":
+		err = parser.Write(os.Stdout, opts.Format, shell, data)
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not print the bindings")
+		}
+		os.Exit(0)
+	case "export":
+		scripts := filepath.Join(filepath.Dir(configFilePath), "scripts")
+		if opts.Scripts != nil {
+			scripts = *opts.Scripts
+		}
+		err = export.Write(os.Stdout, opts.To, data, export.Options{Shell: shell, Globals: globals, Scripts: scripts})
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not export the bindings")
+		}
+		os.Exit(0)
+	case "replay":
+		recording, err := os.Open(opts.Args[0])
 		if err != nil {
-			logger.L().WithError(err).Fatal("can not get executable")
+			logger.L().WithError(err).Fatal("can not open the recording")
 		}
+		err = listener.Replay(recording, data, os.Stdout)
+		if err != nil {
+			logger.L().WithField("file", opts.Args[0]).WithError(err).Fatal("can not replay the recording")
+		}
+		_ = recording.Close()
+		os.Exit(0)
+	}
 
-		if opts.Kill {
-			err = exec.Command("pkill", "-INT", "-x", filepath.Base(execName)).Start()
-		} else {
-			err = exec.Command("pkill", "-USR1", "-x", filepath.Base(execName)).Start()
+	logger.L().WithFields(logrus.Fields{"version": version, "path": configFilePath}).Debug("starting dxhd")
+
+	// catch these signals
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// results of the executed commands
+	results := make(chan listener.Result)
+
+	// the instance this process runs as, once acquired
+	var running *instance.Instance
+
+	var notifier *notify.Notifier
+	if opts.Notify {
+		notifier = notify.New()
+	}
+
+	shutdown := func(sig os.Signal) {
+		logger.L().WithField("signal", sig.String()).Info("signal received, shutting down")
+		if _, err := systemd.Notify(systemd.Stopping); err != nil {
+			logger.L().WithError(err).Debug("can not notify systemd")
+		}
+		if running != nil {
+			running.Release()
 		}
+		// the failures notified of last would be lost otherwise
+		if notifier != nil {
+			notifier.Close()
+		}
+		if env, err := strconv.ParseBool(os.Getenv("STACKTRACE")); env && err == nil {
+			buf := make([]byte, 1<<20)
+			stackLen := runtime.Stack(buf, true)
+			log.Printf("\nPriting goroutine stack trace, because `STACKTRACE` was set.\n%s\n", buf[:stackLen])
+		}
+		os.Exit(0)
+	}
 
-		if err != nil {
-			if opts.Kill {
-				log.Println("can not kill dxhd instances:")
-				log.Fatalln(err)
-			} else {
-				log.Println("can not reload dxhd instances:")
-				log.Fatalln(err)
+	var commands *history.Log
+	if stateDir, err := config.GetStateDir(); err != nil {
+		logger.L().WithError(err).Warn("can not get the state directory, the output of commands won't be kept")
+	} else if commands, err = history.Open(stateDir); err != nil {
+		logger.L().WithError(err).WithField("directory", stateDir).Warn("can not open the history, the output of commands won't be kept")
+	}
+
+	// handleResult decides what's logged and notified of an executed command
+	handleResult := func(res listener.Result) {
+		fields := logrus.Fields{"binding": res.Binding.Original, "command": res.Binding.Command}
+
+		// drags run their command on every motion of the pointer, only the runs which failed are worth keeping,
+		// like the ones of hot corners, which are entered over and over while working
+		continuous := res.Binding.EvtType == parser.EvtButtonDrag || res.Binding.EvtType == parser.EvtHotCorner
+		if commands != nil && res.Err == nil && (!continuous || res.Failed()) {
+			if err := commands.Write(res.Entry()); err != nil {
+				logger.L().WithError(err).Debug("can not write to the history")
 			}
 		}
 
-		if opts.Kill {
-			fmt.Println("killing every running instances of dxhd")
-		} else {
-			fmt.Println("reloading every running instances of dxhd")
+		var reason string
+		switch {
+		case res.Err != nil:
+			reason = "could not be started"
+			logger.L().WithFields(fields).WithError(res.Err).Warn("can not start a command")
+		case res.Signal != 0:
+			reason = "was killed by " + res.Signal.String()
+			logger.L().WithFields(fields).WithField("signal", res.Signal.String()).Warn("a command was killed")
+		case res.ExitCode != 0:
+			reason = "exited with " + strconv.Itoa(res.ExitCode)
+			logger.L().WithFields(fields).WithFields(logrus.Fields{"code": res.ExitCode, "stderr": notify.Tail(res.Stderr, notify.TailLines)}).Warn("a command failed")
+		default:
+			logger.L().WithFields(fields).WithField("took", res.Duration.String()).Debug("a command succeeded")
+			return
 		}
 
-		exit = true
+		if notifier != nil {
+			stderr := res.Stderr
+			if res.Err != nil {
+				stderr = res.Err.Error()
+			}
+			notifier.Failed(res.Binding.Original, reason, stderr)
+		}
 	}
 
-	if exit {
-		os.Exit(0)
+	listenerOpts := listener.Options{Results: results, Scope: opts.Scope}
+
+	if opts.Scope {
+		if _, err := exec.LookPath("systemd-run"); err != nil {
+			logger.L().WithError(err).Warn("systemd-run is not available, commands won't run in their own scope")
+			listenerOpts.Scope = false
+		}
 	}
 
-	logger.L().WithFields(logrus.Fields{"version": version, "path": configFilePath}).Debug("starting dxhd")
+	// the watchdog is pinged as long as the event loop of every display beats, or waits for Xorg to come up,
+	// so a dxhd stuck on a display gets restarted
+	var watchdog <-chan time.Time
+	interval := systemd.WatchdogInterval()
+	if interval > 0 {
+		listenerOpts.HeartbeatInterval = interval / 4
+		ticker := time.NewTicker(interval / 4)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
 
-	// catch these signals
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+	if opts.Record != nil {
+		recording, err := os.OpenFile(*opts.Record, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			logger.L().WithError(err).Fatal("can not open the file to record events to")
+		}
 
-	// errors channel
-	errs := make(chan error)
+		recorder := listener.NewRecorder(recording)
+		listenerOpts.Record = func(rec listener.Record) {
+			if err := recorder.Record(rec); err != nil {
+				logger.L().WithError(err).Warn("can not record an event")
+			}
+		}
+	}
+
+	isUserSignal := func(sig os.Signal) bool {
+		return sig == syscall.SIGUSR1 || sig == syscall.SIGUSR2
+	}
+
+	name := instance.Default
+	if opts.Name != nil {
+		name = *opts.Name
+	} else if opts.Interactive {
+		// temporary bindings should not be in the way of the daemon
+		name = "interactive-" + strconv.Itoa(os.Getpid())
+	}
+	running, err = instance.Acquire(name)
+	if taken, ok := err.(instance.RunningError); ok {
+		logger.L().WithFields(logrus.Fields{"instance": taken.Name, "pid": taken.PID}).Fatal("the instance is already running, use --name to run another one")
+	} else if err != nil {
+		logger.L().WithError(err).WithField("instance", name).Fatal("can not acquire the instance")
+	}
 
 	// infinite loop - if user sends USR signal, reload configration (so, continue loop), otherwise, exit
 toplevel:
@@ -386,52 +607,135 @@ toplevel:
 			}
 		}
 
-		X, err := xgbutil.NewConn()
-		if err != nil {
-			logger.L().WithError(err).Fatal("can not open connection to Xorg")
+		displays := opts.Displays
+		if len(displays) == 0 {
+			// an empty display name makes xgb read $DISPLAY
+			displays = []string{""}
 		}
 
-		keybind.Initialize(X)
-		mousebind.Initialize(X)
-
-		for _, d := range data {
-			err = listener.ListenKeybinding(X, errs, d.EvtType, shell, globals, d.Binding.String(), d.Command.String())
-			if err != nil {
-				logger.L().WithField("keybinding", d.Binding.String()).WithError(err).Warn("can not register a keybinding")
-			}
+		stop := make(chan struct{})
+		wg := new(sync.WaitGroup)
+		// systemd is told dxhd's ready once the first display registered its bindings, or could not be connected
+		// to, a display which is down does not hold the others back nor the start of the unit
+		ready := make(chan string, len(displays))
+		notified := false
+		// the last heartbeats of the displays, in unix nanoseconds
+		beats := make([]int64, len(displays))
+		for i, display := range displays {
+			wg.Add(1)
+			beats[i] = time.Now().UnixNano()
+			go func(display string, beat *int64) {
+				defer wg.Done()
+				opts := listenerOpts
+				opts.Shell, opts.Globals = shell, globals
+				opts.RawInput = listener.XInputDialer(display)
+				notify := func(msg string) {
+					select {
+					case ready <- msg:
+					default:
+					}
+				}
+				opts.Ready = func(failed int) {
+					atomic.StoreInt64(beat, time.Now().UnixNano())
+					if failed == 0 {
+						notify("every binding is registered")
+					} else {
+						notify(fmt.Sprintf("%d bindings could not be registered", failed))
+					}
+				}
+				opts.Waiting = func(error) {
+					notify("Xorg is not up yet, the bindings are registered once it is")
+				}
+				if interval > 0 {
+					opts.Heartbeat = func() {
+						atomic.StoreInt64(beat, time.Now().UnixNano())
+					}
+				}
+				listener.Serve(display, listener.XDialer(display), data, opts, stop)
+			}(display, &beats[i])
 		}
 
-		data = nil
-
-		go xevent.Main(X)
-
 		for {
 			select {
-			case err = <-errs:
-				if err != nil {
-					logger.L().WithError(err).Warn("a command resulted into an error")
+			case res := <-results:
+				handleResult(res)
+				continue
+			case msg := <-ready:
+				if notified {
+					continue
+				}
+				notified = true
+				if _, err := systemd.Notify(systemd.Ready); err != nil {
+					logger.L().WithError(err).Warn("can not notify systemd")
+				}
+				daemon.Ready(msg)
+				continue
+			case <-watchdog:
+				if display, stuck := stuckDisplay(displays, beats, interval/2); stuck {
+					logger.L().WithField("display", display).Warn("the event loop is stuck, the systemd watchdog is not pinged")
+					continue
+				}
+				if _, err := systemd.Notify(systemd.Watchdog); err != nil {
+					logger.L().WithError(err).Debug("can not ping the systemd watchdog")
 				}
 				continue
 			case sig := <-signals:
-				if (sig == syscall.SIGUSR1 || sig == syscall.SIGUSR2) && stdin != nil {
+				if isUserSignal(sig) && stdin != nil {
 					logger.L().Debug("user defined signal received, but not reloading, as dxhd's using memory config")
 					continue
 				}
-				keybind.Detach(X, X.RootWin())
-				mousebind.Detach(X, X.RootWin())
-				xevent.Quit(X)
-				if (sig == syscall.SIGUSR1 || sig == syscall.SIGUSR2) && stdin == nil {
+				close(stop)
+				wg.Wait()
+				if isUserSignal(sig) {
 					logger.L().Debug("user defined signal received, reloading")
+					if _, err := systemd.Notify(systemd.Reloading); err != nil {
+						logger.L().WithError(err).Debug("can not notify systemd")
+					}
+					data = nil
 					continue toplevel
 				}
-				logger.L().WithField("signal", sig.String()).Info("signal received, shutting down")
-				if env, err := strconv.ParseBool(os.Getenv("STACKTRACE")); env && err == nil {
-					buf := make([]byte, 1<<20)
-					stackLen := runtime.Stack(buf, true)
-					log.Printf("\nPriting goroutine stack trace, because `STACKTRACE` was set.\n%s\n", buf[:stackLen])
-				}
-				os.Exit(0)
+				shutdown(sig)
 			}
 		}
 	}
 }
+
+// stuckDisplay returns the first display whose last heartbeat is older than given age
+func stuckDisplay(displays []string, beats []int64, age time.Duration) (display string, stuck bool) {
+	for i, display := range displays {
+		if time.Since(time.Unix(0, atomic.LoadInt64(&beats[i]))) > age {
+			return display, true
+		}
+	}
+	return
+}
+
+// formatConfig formats the config in place, or prints the formatted one read from stdin, and exits;
+// with check, it only tells whether the config is formatted
+func formatConfig(path string, stdin *[]byte, check bool) {
+	var (
+		src []byte
+		err error
+	)
+	if stdin != nil {
+		src, path = *stdin, "<stdin>"
+	} else if src, err = ioutil.ReadFile(path); err != nil {
+		logger.L().WithError(err).WithField("file", path).Fatal("can not read the config")
+	}
+
+	formatted := parser.Format(parser.ParseTree(src))
+	switch {
+	case check:
+		if !bytes.Equal(src, formatted) {
+			fmt.Println(path + " is not formatted")
+			os.Exit(1)
+		}
+	case stdin != nil:
+		_, _ = os.Stdout.Write(formatted)
+	case !bytes.Equal(src, formatted):
+		if err = ioutil.WriteFile(path, formatted, 0644); err != nil {
+			logger.L().WithError(err).WithField("file", path).Fatal("can not write the formatted config")
+		}
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,454 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout is how long a method call waits for its reply
+var Timeout = time.Second * 5
+
+// message types
+const (
+	methodCall   = 1
+	methodReturn = 2
+	errorReply   = 3
+)
+
+// header fields
+const (
+	fieldPath        = 1
+	fieldInterface   = 2
+	fieldMember      = 3
+	fieldErrorName   = 4
+	fieldReplySerial = 5
+	fieldDestination = 6
+	fieldSignature   = 8
+)
+
+// Conn is a connection to a D-Bus bus
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	serial uint32
+	mu     sync.Mutex
+}
+
+// message is a D-Bus message, only the header fields dxhd deals with are kept
+type message struct {
+	order       binary.ByteOrder
+	typ         byte
+	serial      uint32
+	path        string
+	iface       string
+	member      string
+	errorName   string
+	replySerial uint32
+	destination string
+	signature   string
+	body        []byte
+}
+
+// Dial connects to given bus address, an empty address means $DBUS_SESSION_BUS_ADDRESS
+func Dial(address string) (c *Conn, err error) {
+	if address == "" {
+		address = os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	}
+	if address == "" {
+		return nil, errors.New("DBUS_SESSION_BUS_ADDRESS is not set")
+	}
+
+	conn, err := dial(address)
+	if err != nil {
+		return
+	}
+
+	c = &Conn{conn: conn, reader: bufio.NewReader(conn)}
+
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+			c = nil
+		}
+	}()
+
+	if err = c.auth(); err != nil {
+		return
+	}
+
+	_, err = c.call(message{
+		path:        "/org/freedesktop/DBus",
+		iface:       "org.freedesktop.DBus",
+		member:      "Hello",
+		destination: "org.freedesktop.DBus",
+	})
+
+	return
+}
+
+// dial opens the first usable unix socket of a bus address like unix:path=/run/user/1000/bus
+func dial(address string) (conn net.Conn, err error) {
+	err = fmt.Errorf("no supported transport in %q", address)
+
+	for _, addr := range strings.Split(address, ";") {
+		if !strings.HasPrefix(addr, "unix:") {
+			continue
+		}
+		for _, kv := range strings.Split(strings.TrimPrefix(addr, "unix:"), ",") {
+			var path string
+			switch {
+			case strings.HasPrefix(kv, "path="):
+				path = strings.TrimPrefix(kv, "path=")
+			case strings.HasPrefix(kv, "abstract="):
+				path = "@" + strings.TrimPrefix(kv, "abstract=")
+			default:
+				continue
+			}
+			if conn, err = net.Dial("unix", unescape(path)); err == nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// unescape decodes the %xx escapes of an address value
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// auth authenticates with the EXTERNAL mechanism, the bus checks the credentials of the socket
+func (c *Conn) auth() error {
+	if err := c.conn.SetDeadline(time.Now().Add(Timeout)); err != nil {
+		return err
+	}
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := c.conn.Write([]byte("\x00AUTH EXTERNAL " + uid + "\r\n")); err != nil {
+		return err
+	}
+
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("the bus refused the authentication (%s)", strings.TrimSpace(line))
+	}
+
+	_, err = c.conn.Write([]byte("BEGIN\r\n"))
+	return err
+}
+
+// Notify shows a notification, it returns its id
+func (c *Conn) Notify(summary, body string) (id uint32, err error) {
+	e := new(encoder)
+	e.string("dxhd")         // app_name
+	e.uint32(0)              // replaces_id
+	e.string("dialog-error") // app_icon
+	e.string(summary)        // summary
+	e.string(body)           // body
+	e.array(4, func() {})    // actions
+	e.array(8, func() {})    // hints
+	e.uint32(^uint32(0))     // expire_timeout, -1 lets the server decide
+
+	reply, err := c.call(message{
+		path:        "/org/freedesktop/Notifications",
+		iface:       "org.freedesktop.Notifications",
+		member:      "Notify",
+		destination: "org.freedesktop.Notifications",
+		signature:   "susssasa{sv}i",
+		body:        e.buf,
+	})
+	if err != nil {
+		return
+	}
+
+	d := decoder{buf: reply.body, order: reply.order}
+	id = d.uint32()
+	err = d.err
+	return
+}
+
+// Close closes the connection
+func (c *Conn) Close() {
+	_ = c.conn.Close()
+}
+
+// call sends a method call and waits for its reply, anything else received meanwhile is dropped
+func (c *Conn) call(msg message) (reply message, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a bus which stopped responding must not hang the caller
+	if err = c.conn.SetDeadline(time.Now().Add(Timeout)); err != nil {
+		return
+	}
+
+	c.serial++
+	msg.typ = methodCall
+	msg.serial = c.serial
+	if _, err = c.conn.Write(msg.encode()); err != nil {
+		return
+	}
+
+	for {
+		reply, err = readMessage(c.reader)
+		if err != nil {
+			return
+		}
+		if reply.replySerial != msg.serial {
+			continue
+		}
+		if reply.typ == errorReply {
+			err = fmt.Errorf("%s: %s", reply.errorName, reply.errorMessage())
+		}
+		return
+	}
+}
+
+// errorMessage returns the message of an error reply, if it has one
+func (m message) errorMessage() string {
+	if !strings.HasPrefix(m.signature, "s") {
+		return "no message"
+	}
+	d := decoder{buf: m.body, order: m.order}
+	return d.string()
+}
+
+// encoder marshals values, aligned relatively to the start of its buffer
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) align(n int) {
+	for len(e.buf)%n != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf = append(e.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(e.buf[len(e.buf)-4:], v)
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+func (e *encoder) signature(s string) {
+	e.byte(byte(len(s)))
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, 0)
+}
+
+// array writes an array, its elements are written by f and aligned to elemAlign
+func (e *encoder) array(elemAlign int, f func()) {
+	e.uint32(0)
+	pos := len(e.buf) - 4
+	e.align(elemAlign)
+	start := len(e.buf)
+	f()
+	binary.LittleEndian.PutUint32(e.buf[pos:], uint32(len(e.buf)-start))
+}
+
+// encode marshals a message in little endian
+func (m message) encode() []byte {
+	e := new(encoder)
+	e.byte('l')
+	e.byte(m.typ)
+	e.byte(0)
+	e.byte(1)
+	e.uint32(uint32(len(m.body)))
+	e.uint32(m.serial)
+
+	field := func(code byte, sig string, f func()) {
+		e.align(8)
+		e.byte(code)
+		e.signature(sig)
+		f()
+	}
+	str := func(code byte, sig, value string) {
+		if value == "" {
+			return
+		}
+		field(code, sig, func() {
+			if sig == "g" {
+				e.signature(value)
+			} else {
+				e.string(value)
+			}
+		})
+	}
+
+	e.array(8, func() {
+		str(fieldPath, "o", m.path)
+		str(fieldInterface, "s", m.iface)
+		str(fieldMember, "s", m.member)
+		str(fieldErrorName, "s", m.errorName)
+		if m.replySerial != 0 {
+			field(fieldReplySerial, "u", func() { e.uint32(m.replySerial) })
+		}
+		str(fieldDestination, "s", m.destination)
+		str(fieldSignature, "g", m.signature)
+	})
+	e.align(8)
+
+	return append(e.buf, m.body...)
+}
+
+// decoder unmarshals values, aligned relatively to the start of its buffer
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	err   error
+}
+
+func (d *decoder) align(n int) {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || d.pos+n > len(d.buf) {
+		d.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) byte() byte {
+	return d.next(1)[0]
+}
+
+func (d *decoder) uint32() uint32 {
+	d.align(4)
+	return d.order.Uint32(d.next(4))
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	s := string(d.next(int(n)))
+	d.next(1)
+	return s
+}
+
+func (d *decoder) signature() string {
+	n := d.byte()
+	s := string(d.next(int(n)))
+	d.next(1)
+	return s
+}
+
+// skipArray skips an array of elements aligned to elemAlign
+func (d *decoder) skipArray(elemAlign int) {
+	n := d.uint32()
+	d.align(elemAlign)
+	d.next(int(n))
+}
+
+// readMessage reads a message, its header fields of basic types are decoded
+func readMessage(r io.Reader) (m message, err error) {
+	fixed := make([]byte, 16)
+	if _, err = io.ReadFull(r, fixed); err != nil {
+		return
+	}
+
+	switch fixed[0] {
+	case 'l':
+		m.order = binary.LittleEndian
+	case 'B':
+		m.order = binary.BigEndian
+	default:
+		err = fmt.Errorf("invalid byte order %q", fixed[0])
+		return
+	}
+	m.typ = fixed[1]
+	bodyLen := int(m.order.Uint32(fixed[4:]))
+	m.serial = m.order.Uint32(fixed[8:])
+	fieldsLen := int(m.order.Uint32(fixed[12:]))
+
+	headerLen := 16 + fieldsLen
+	headerLen += (8 - headerLen%8) % 8
+	buf := make([]byte, headerLen+bodyLen)
+	copy(buf, fixed)
+	if _, err = io.ReadFull(r, buf[16:]); err != nil {
+		return
+	}
+
+	d := decoder{buf: buf[:16+fieldsLen], pos: 16, order: m.order}
+	for d.err == nil && d.pos < len(d.buf) {
+		d.align(8)
+		code := d.byte()
+		sig := d.signature()
+		switch sig {
+		case "s", "o":
+			value := d.string()
+			switch code {
+			case fieldPath:
+				m.path = value
+			case fieldInterface:
+				m.iface = value
+			case fieldMember:
+				m.member = value
+			case fieldErrorName:
+				m.errorName = value
+			case fieldDestination:
+				m.destination = value
+			}
+		case "g":
+			value := d.signature()
+			if code == fieldSignature {
+				m.signature = value
+			}
+		case "u":
+			value := d.uint32()
+			if code == fieldReplySerial {
+				m.replySerial = value
+			}
+		default:
+			err = fmt.Errorf("unexpected header field of type %q", sig)
+			return
+		}
+	}
+	if d.err != nil {
+		err = d.err
+		return
+	}
+
+	m.body = buf[headerLen:]
+	return
+}
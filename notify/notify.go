@@ -0,0 +1,141 @@
+// Package notify sends freedesktop desktop notifications over D-Bus when commands fail
+//
+// There are no D-Bus bindings among dxhd's dependencies, so this package speaks just enough of the protocol
+// to call org.freedesktop.Notifications.Notify on the session bus.
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dakyskye/dxhd/logger"
+)
+
+// TailLines is how many of the last lines of stderr a notification shows
+const TailLines = 5
+
+// Notifier notifies of failed commands, at most once per Interval for each binding
+//
+// Notifications are sent in the background, one at a time, a failure notified of while one is still waiting to be
+// sent is counted in the next notification of its binding instead.
+type Notifier struct {
+	// Interval is the least time between two notifications of the same binding
+	Interval time.Duration
+	// Send shows a notification, it's Conn.Notify over the session bus by default
+	Send func(summary, body string) error
+
+	conn       *Conn
+	last       map[string]time.Time
+	suppressed map[string]int
+	queue      chan queued
+	closed     bool
+	sent       chan struct{}
+	mu         sync.Mutex
+}
+
+// queued is a notification waiting to be sent
+type queued struct {
+	summary, body string
+}
+
+// New returns a notifier sending notifications over the session bus, connecting on its first notification
+func New() *Notifier {
+	n := &Notifier{
+		Interval:   time.Minute,
+		last:       make(map[string]time.Time),
+		suppressed: make(map[string]int),
+		// the notification being sent is not in the queue, so one more can wait
+		queue: make(chan queued, 1),
+		sent:  make(chan struct{}),
+	}
+	n.Send = n.sendSession
+	go n.send()
+	return n
+}
+
+// send sends the queued notifications until the notifier is closed
+func (n *Notifier) send() {
+	for msg := range n.queue {
+		if err := n.Send(msg.summary, msg.body); err != nil {
+			logger.L().WithError(err).Warn("can not send a notification")
+		}
+	}
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	close(n.sent)
+}
+
+// sendSession sends a notification over the session bus, reconnecting if the connection was lost
+func (n *Notifier) sendSession(summary, body string) (err error) {
+	if n.conn == nil {
+		if n.conn, err = Dial(""); err != nil {
+			return
+		}
+	}
+
+	if _, err = n.conn.Notify(summary, body); err != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	return
+}
+
+// Failed notifies that the command of a binding failed for given reason, like "exited with 1",
+// unless the binding was notified of recently, it does not wait for the notification to be sent
+func (n *Notifier) Failed(binding, reason, stderr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := n.last[binding]; n.closed || ok && now.Sub(last) < n.Interval {
+		n.suppressed[binding]++
+		return
+	}
+
+	body := reason
+	if suppressed := n.suppressed[binding]; suppressed > 0 {
+		body += fmt.Sprintf(", %d more failures were not shown", suppressed)
+	}
+	if tail := Tail(stderr, TailLines); tail != "" {
+		body += "\n" + escape(tail)
+	}
+
+	select {
+	case n.queue <- queued{"dxhd: " + binding + " failed", body}:
+		n.last[binding] = now
+		delete(n.suppressed, binding)
+	default:
+		n.suppressed[binding]++
+	}
+}
+
+// Close stops sending notifications, it waits for the notification being sent and the one waiting to be, then
+// closes the connection to the session bus, if any
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	<-n.sent
+}
+
+// Tail returns the last lines of s
+func Tail(s string, lines int) string {
+	split := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(split) > lines {
+		split = split[len(split)-lines:]
+	}
+	return strings.Join(split, "\n")
+}
+
+// escape escapes the markup notification servers may interpret
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,268 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type notification struct {
+	summary, body string
+}
+
+// fakeService is a local bus serving org.freedesktop.Notifications
+type fakeService struct {
+	address       string
+	notifications chan notification
+}
+
+func newFakeService(t *testing.T) *fakeService {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bus")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &fakeService{address: "unix:path=" + path, notifications: make(chan notification, 16)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(t, conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeService) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		t.Errorf("unexpected authentication %q", line)
+		return
+	}
+	conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	if line, err = r.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		t.Errorf("expected BEGIN, got %q", line)
+		return
+	}
+
+	var serial uint32
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			return
+		}
+
+		serial++
+		reply := message{typ: methodReturn, serial: serial, replySerial: msg.serial}
+		e := new(encoder)
+
+		switch msg.member {
+		case "Hello":
+			// a signal before the reply, like the bus sends, has to be skipped
+			signal := message{typ: 4, serial: serial, path: "/org/freedesktop/DBus", iface: "org.freedesktop.DBus", member: "NameAcquired"}
+			conn.Write(signal.encode())
+			serial++
+			reply.serial = serial
+			e.string(":1.1")
+			reply.signature = "s"
+		case "Notify":
+			if msg.signature != "susssasa{sv}i" || msg.destination != "org.freedesktop.Notifications" {
+				t.Errorf("unexpected Notify call %+v", msg)
+			}
+			d := decoder{buf: msg.body, order: msg.order}
+			d.string()
+			d.uint32()
+			d.string()
+			n := notification{summary: d.string(), body: d.string()}
+			d.skipArray(4)
+			d.skipArray(8)
+			d.uint32()
+			if d.err != nil {
+				t.Errorf("malformed Notify body: %v", d.err)
+			}
+			s.notifications <- n
+			e.uint32(serial)
+			reply.signature = "u"
+		default:
+			reply.typ = errorReply
+			reply.errorName = "org.freedesktop.DBus.Error.UnknownMethod"
+			e.string("unknown method " + msg.member)
+			reply.signature = "s"
+		}
+
+		reply.body = e.buf
+		conn.Write(reply.encode())
+	}
+}
+
+func (s *fakeService) expect(t *testing.T) notification {
+	t.Helper()
+
+	select {
+	case n := <-s.notifications:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("expected a notification")
+	}
+	return notification{}
+}
+
+func TestNotify(t *testing.T) {
+	s := newFakeService(t)
+
+	conn, err := Dial(s.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	id, err := conn.Notify("dxhd: super+a failed", "exited with 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == 0 {
+		t.Fatal("expected a notification id")
+	}
+
+	if n := s.expect(t); n.summary != "dxhd: super+a failed" || n.body != "exited with 1" {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	s := newFakeService(t)
+
+	conn, err := Dial(s.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_, err = conn.call(message{path: "/", member: "Nope", destination: "org.freedesktop.Notifications"})
+	if err == nil || !strings.Contains(err.Error(), "unknown method Nope") {
+		t.Fatalf("expected the error reply, got %v", err)
+	}
+}
+
+func TestNotifierRateLimits(t *testing.T) {
+	s := newFakeService(t)
+
+	n := New()
+	defer n.Close()
+	n.Interval = time.Millisecond * 100
+	n.Send = func(summary, body string) error {
+		conn, err := Dial(s.address)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = conn.Notify(summary, body)
+		return err
+	}
+
+	stderr := "line 1\nline 2\nline 3\nline 4\nline 5\n<line 6>\n"
+	for i := 0; i < 3; i++ {
+		n.Failed("super+a", "exited with 2", stderr)
+	}
+
+	first := s.expect(t)
+	if first.summary != "dxhd: super+a failed" || first.body != "exited with 2\nline 2\nline 3\nline 4\nline 5\n&lt;line 6&gt;" {
+		t.Fatalf("unexpected notification %+v", first)
+	}
+	n.Failed("super+b", "could not run", "")
+	if other := s.expect(t); other.summary != "dxhd: super+b failed" || other.body != "could not run" {
+		t.Fatalf("unexpected notification %+v", other)
+	}
+
+	select {
+	case n := <-s.notifications:
+		t.Fatalf("expected repeated failures to be rate limited, got %+v", n)
+	case <-time.After(time.Millisecond * 150):
+	}
+
+	n.Failed("super+a", "exited with 2", "")
+	if again := s.expect(t); again.body != "exited with 2, 2 more failures were not shown" {
+		t.Fatalf("unexpected notification %+v", again)
+	}
+}
+
+func TestNotifierDoesNotWait(t *testing.T) {
+	n := New()
+	defer n.Close()
+	sent, release := make(chan string, 3), make(chan struct{})
+	n.Send = func(summary, body string) error {
+		sent <- summary
+		<-release
+		return nil
+	}
+
+	n.Failed("super+a", "exited with 1", "")
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("expected the first notification to be sent")
+	}
+
+	// the first one is still being sent, the second one waits and the third one is dropped
+	done := make(chan struct{})
+	go func() {
+		n.Failed("super+b", "exited with 1", "")
+		n.Failed("super+c", "exited with 1", "")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected failures not to wait for notifications to be sent")
+	}
+	close(release)
+
+	select {
+	case summary := <-sent:
+		if summary != "dxhd: super+b failed" {
+			t.Fatalf("expected super+b to be notified of, got %q", summary)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the waiting notification to be sent")
+	}
+	select {
+	case summary := <-sent:
+		t.Fatalf("expected the notification to be dropped, got %q", summary)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func TestNotifierCloseSendsQueued(t *testing.T) {
+	n := New()
+	started := make(chan struct{}, 2)
+	var sent []string
+	n.Send = func(summary, body string) error {
+		started <- struct{}{}
+		time.Sleep(time.Millisecond * 50)
+		sent = append(sent, summary)
+		return nil
+	}
+
+	// the second failure waits while the first one is being sent
+	n.Failed("super+a", "exited with 1", "")
+	<-started
+	n.Failed("super+b", "exited with 1", "")
+	n.Close()
+
+	if len(sent) != 2 {
+		t.Fatalf("expected the notifications to be sent before Close returned, got %q", sent)
+	}
+}
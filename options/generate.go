@@ -0,0 +1,356 @@
+package options
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Shells are the shells Completion generates completions for
+var Shells = []string{"bash", "zsh", "fish"}
+
+// takesFiles reports whether an argument, as named in Option.Arg or Command.Args, is a file
+func takesFiles(arg string) bool {
+	switch strings.Trim(arg, "[]") {
+	case "path", "file", "FILE":
+		return true
+	}
+	return false
+}
+
+// argWords returns the words the positional argument of a command is one of, nil if it is free-form
+func argWords(cmd *Command) (words []string) {
+	switch strings.Trim(cmd.Args, "[]") {
+	case "COMMAND":
+		for _, c := range Commands {
+			words = append(words, c.Name)
+		}
+	case "SHELL":
+		words = Shells
+	}
+	return
+}
+
+// commandsTaking returns the names of the commands taking given option besides the global ones
+func commandsTaking(opt *Option) (names []string) {
+	for _, cmd := range Commands {
+		for _, name := range cmd.Options {
+			if name == opt.Long {
+				names = append(names, cmd.Name)
+			}
+		}
+	}
+	return
+}
+
+// Completion writes the completion script of given shell to w
+func Completion(w io.Writer, shell string) error {
+	switch shell {
+	case "bash":
+		return bashCompletion(w)
+	case "zsh":
+		return zshCompletion(w)
+	case "fish":
+		return fishCompletion(w)
+	}
+	return fmt.Errorf("%s is not a supported shell, use one of %s", shell, strings.Join(Shells, ", "))
+}
+
+func bashCompletion(w io.Writer) error {
+	var names, files, args, cmdOpts, cmdArgs strings.Builder
+	for _, opt := range All {
+		flags := "--" + opt.Long
+		if opt.Short != 0 {
+			flags = fmt.Sprintf("-%c|--%s", opt.Short, opt.Long)
+		}
+		switch {
+		case opt.Arg == "" || opt.Optional:
+		case takesFiles(opt.Arg):
+			files.WriteString("|" + flags)
+		default:
+			args.WriteString("|" + flags)
+		}
+	}
+	for _, cmd := range Commands {
+		names.WriteString(" " + cmd.Name)
+		fmt.Fprintf(&cmdOpts, "\t\t%s) opts=%q ;;\n", cmd.Name, strings.Join(longOptions(cmd, true), " "))
+		switch words := argWords(cmd); {
+		case words != nil:
+			fmt.Fprintf(&cmdArgs, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", cmd.Name, strings.Join(words, " "))
+		case takesFiles(cmd.Args):
+			fmt.Fprintf(&cmdArgs, "\t%s) COMPREPLY=($(compgen -f -- \"$cur\")) ;;\n", cmd.Name)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `# bash completion for dxhd, generated by dxhd completion bash
+
+_dxhd() {
+	local cur prev cmd opts i
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+	cmd=""
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		%s) cmd="${COMP_WORDS[i]}"; break ;;
+		esac
+	done
+
+	case "$prev" in
+	%s) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+	%s) return ;;
+	esac
+
+	if [[ "$cur" == -* ]]; then
+		case "$cmd" in
+		"") opts=%q ;;
+%s		esac
+		COMPREPLY=($(compgen -W "$opts" -- "$cur"))
+		return
+	fi
+
+	case "$cmd" in
+	"") COMPREPLY=($(compgen -W %q -- "$cur")) ;;
+%s	esac
+}
+
+complete -F _dxhd dxhd
+`, strings.ReplaceAll(strings.TrimSpace(names.String()), " ", "|"), strings.TrimPrefix(files.String(), "|"),
+		strings.TrimPrefix(args.String(), "|"), strings.Join(longOptions(FindCommand(DefaultCommand), false), " "),
+		cmdOpts.String(), strings.TrimSpace(names.String()), cmdArgs.String())
+	return err
+}
+
+// longOptions returns the long names of the options of a command, with the aliases only if the command is implicit
+func longOptions(cmd *Command, explicit bool) (names []string) {
+	for _, opt := range takes(cmd, explicit) {
+		names = append(names, "--"+opt.Long)
+	}
+	return
+}
+
+// zshEscape escapes s for a single quoted string of zsh, and the characters _arguments and _describe treat specially
+func zshEscape(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func zshCompletion(w io.Writer) error {
+	var cmds, cases strings.Builder
+	for _, cmd := range Commands {
+		fmt.Fprintf(&cmds, "\t\t'%s:%s'\n", cmd.Name, zshEscape(cmd.Usage))
+		fmt.Fprintf(&cases, "\t%s)\n\t\t_arguments -s -S%s ;;\n", cmd.Name, zshSpecs(cmd, true))
+	}
+
+	_, err := fmt.Fprintf(w, `#compdef dxhd
+# zsh completion for dxhd, generated by dxhd completion zsh
+
+_dxhd() {
+	local -a commands
+	commands=(
+%s	)
+
+	if (( CURRENT == 2 )) && [[ $words[2] != -* ]]; then
+		_describe -t commands 'dxhd command' commands
+		return
+	fi
+	if (( CURRENT > 2 )) && (( ${commands[(I)${words[2]}:*]} )); then
+		local cmd=$words[2]
+		shift words
+		(( CURRENT-- ))
+	else
+		_arguments -s -S%s
+		return
+	fi
+
+	case $cmd in
+%s	esac
+}
+
+_dxhd "$@"
+`, cmds.String(), zshSpecs(FindCommand(DefaultCommand), false), cases.String())
+	return err
+}
+
+// zshSpecs returns the _arguments specs of the options and arguments of a command
+func zshSpecs(cmd *Command, explicit bool) string {
+	var b strings.Builder
+	for _, opt := range takes(cmd, explicit) {
+		action := ""
+		if opt.Arg != "" {
+			colons := ":"
+			if opt.Optional {
+				colons = "::"
+			}
+			action = colons + opt.Arg + ":"
+			if takesFiles(opt.Arg) {
+				action += "_files"
+			}
+		}
+		usage := "[" + zshEscape(opt.Usage) + "]"
+		if opt.Short != 0 {
+			fmt.Fprintf(&b, " \\\n\t\t\t'(-%c --%s)'{-%c,--%s}'%s%s'", opt.Short, opt.Long, opt.Short, opt.Long, usage, action)
+		} else {
+			fmt.Fprintf(&b, " \\\n\t\t\t'--%s%s%s'", opt.Long, usage, action)
+		}
+	}
+	if cmd.MaxArgs > 0 {
+		colons := ":"
+		if cmd.MinArgs == 0 {
+			colons = "::"
+		}
+		action := ""
+		if words := argWords(cmd); words != nil {
+			action = "(" + strings.Join(words, " ") + ")"
+		} else if takesFiles(cmd.Args) {
+			action = "_files"
+		}
+		fmt.Fprintf(&b, " \\\n\t\t\t'1%s%s:%s'", colons, strings.ToLower(strings.Trim(cmd.Args, "[]")), action)
+	}
+	return b.String()
+}
+
+// fishQuote quotes s for fish
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func fishCompletion(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("# fish completion for dxhd, generated by dxhd completion fish\n\ncomplete -c dxhd -f\n\n")
+
+	for _, cmd := range Commands {
+		fmt.Fprintf(&b, "complete -c dxhd -n __fish_use_subcommand -a %s -d %s\n", cmd.Name, fishQuote(cmd.Usage))
+	}
+	b.WriteString("\n")
+
+	global := make(map[string]bool)
+	for _, name := range Global {
+		global[name] = true
+	}
+	for _, opt := range All {
+		condition := ""
+		if !global[opt.Long] {
+			// the default command takes its options only when given implicitly, if they are aliases
+			implicit, explicit := false, []string{}
+			for _, name := range commandsTaking(opt) {
+				if name == DefaultCommand {
+					implicit = true
+					if opt.Alias != "" && opt.set == nil {
+						continue
+					}
+				}
+				explicit = append(explicit, name)
+			}
+			conditions := []string{}
+			if implicit {
+				conditions = append(conditions, "__fish_use_subcommand")
+			}
+			if len(explicit) > 0 {
+				conditions = append(conditions, "__fish_seen_subcommand_from "+strings.Join(explicit, " "))
+			}
+			condition = " -n " + fishQuote(strings.Join(conditions, "; or "))
+		}
+
+		flags := " -l " + opt.Long
+		if opt.Short != 0 {
+			flags = fmt.Sprintf(" -s %c%s", opt.Short, flags)
+		}
+		switch {
+		case opt.Arg == "":
+		case opt.Optional:
+		case takesFiles(opt.Arg):
+			flags += " -r -F"
+		default:
+			flags += " -x"
+		}
+		fmt.Fprintf(&b, "complete -c dxhd%s%s -d %s\n", condition, flags, fishQuote(opt.Usage))
+	}
+	b.WriteString("\n")
+
+	for _, cmd := range Commands {
+		seen := " -n " + fishQuote("__fish_seen_subcommand_from "+cmd.Name)
+		if words := argWords(cmd); words != nil {
+			fmt.Fprintf(&b, "complete -c dxhd%s -a %s\n", seen, fishQuote(strings.Join(words, " ")))
+		} else if takesFiles(cmd.Args) {
+			fmt.Fprintf(&b, "complete -c dxhd%s -F\n", seen)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// roff escapes s for a man page
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Manual writes the roff man page of dxhd to w
+func Manual(w io.Writer, version string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH DXHD 1 \"\" %q \"dxhd manual\"\n", "dxhd "+version)
+	fmt.Fprintf(&b, ".SH NAME\ndxhd \\- %s\n", roff(Summary))
+	b.WriteString(".SH SYNOPSIS\n.B dxhd\n[\\fIOPTIONS\\fR]\n.br\n.B dxhd\n\\fICOMMAND\\fR [\\fIARGS\\fR] [\\fIOPTIONS\\fR]\n")
+	fmt.Fprintf(&b, ".SH DESCRIPTION\n%s\n", roff(Description))
+
+	b.WriteString(".SH COMMANDS\n")
+	for _, cmd := range Commands {
+		fmt.Fprintf(&b, ".TP\n.B %s", cmd.Name)
+		if cmd.Args != "" {
+			fmt.Fprintf(&b, " \\fI%s\\fR", cmd.Args)
+		}
+		fmt.Fprintf(&b, "\n%s\n", roff(cmd.Usage))
+	}
+
+	global := make(map[string]bool)
+	for _, name := range Global {
+		global[name] = true
+	}
+	b.WriteString(".SH OPTIONS\n")
+	for _, opt := range All {
+		b.WriteString(".TP\n")
+		if opt.Short != 0 {
+			fmt.Fprintf(&b, "\\fB\\-%c\\fR, ", opt.Short)
+		}
+		fmt.Fprintf(&b, "\\fB\\-\\-%s\\fR", roff(opt.Long))
+		switch {
+		case opt.Arg != "" && opt.Optional:
+			fmt.Fprintf(&b, " [\\fI%s\\fR]", opt.Arg)
+		case opt.Arg != "":
+			fmt.Fprintf(&b, " \\fI%s\\fR", opt.Arg)
+		}
+		usage := opt.Usage
+		if opt.Env != "" {
+			usage += ", $" + opt.Env + " by default"
+		}
+		if opt.Alias != "" && opt.set == nil {
+			usage += ", only when no command is given"
+		} else if !global[opt.Long] {
+			usage += ". Taken by " + strings.Join(commandsTaking(opt), ", ")
+		}
+		fmt.Fprintf(&b, "\n%s\n", roff(usage))
+	}
+
+	b.WriteString(".SH ENVIRONMENT\n")
+	for _, opt := range All {
+		if opt.Env != "" {
+			fmt.Fprintf(&b, ".TP\n.B %s\nThe default of \\fB\\-\\-%s\\fR\n", opt.Env, roff(opt.Long))
+		}
+	}
+	b.WriteString(".TP\n.B EDITOR\nThe editor the edit command opens\n")
+	b.WriteString(".SH FILES\n.TP\n.I ~/.config/dxhd/dxhd.sh\nThe default config\n")
+	b.WriteString(".TP\n.I ~/.local/state/dxhd/\nThe output of the commands run, see the history command\n")
+	fmt.Fprintf(&b, ".SH EXAMPLE\n.nf\n%s\n.fi\n", roff(ExampleConfig))
+	fmt.Fprintf(&b, ".SH BUGS\n%s\n", roff(Bugs))
+	fmt.Fprintf(&b, ".SH AUTHOR\n%s\n", roff(Author))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -7,151 +7,370 @@ import (
 	"strings"
 )
 
+// Options are the parsed command line
 type Options struct {
+	// Command is the command to run, run if none was given
+	Command string
+	// Args are the positional arguments of the command
+	Args        []string
 	Help        bool
-	Kill        bool
-	Reload      bool
 	Version     bool
-	DryRun      bool
 	ParseTime   bool
 	Background  bool
 	Interactive bool
 	Config      *string
-	Edit        *string
+	Displays    []string
+	Record      *string
+	// Format is the format list prints the bindings in
+	Format string
+	// To is the format export exports the bindings to
+	To string
+	// Scripts is where export writes scripts to
+	Scripts *string
+	// Check makes fmt only report whether the config is formatted
+	Check  bool
+	Notify bool
+	Scope  bool
+	Name   *string
+	// LogFile is where the output of a background dxhd goes, /dev/null if nil
+	LogFile *string
+	// Ignored are the long names of the options given which do nothing for the command an old flag ran
+	Ignored []string
 }
 
-var OptionsToPrint = `
-  -h, --help              Prints this help message
-  -c, --config [path]     Reads the config from custom path
-  -d, --dry-run           Prints bindings and their commands and exits
-  -b, --background        Runs dxhd in the background
-  -k, --kill              Gracefully kills every running instances of dxhd
-  -p, --parse-time        Prints how much time parsing a config took
-  -r, --reload            Reloads every running instances of dxhd
-  -v, --version           Prints current version of program
-  -e, --edit [file]       Shortcut to edit a file in dxhd's config folder. Opens dxhd.sh if file is empty
-  -i, --interactive       Opens a temporary file for temporary bindings to run`
+// Option describes a command line option
+type Option struct {
+	Long  string
+	Short rune
+	// Arg names the argument of the option, an option without one is a switch
+	Arg string
+	// Optional arguments are only read from the next argument if it's not an option
+	Optional bool
+	// Env names an environment variable the option defaults to
+	Env   string
+	Usage string
+	// Alias makes the option, when no command is given, run a command instead, as it did before dxhd had commands
+	Alias string
+	set   func(opts *Options, arg *string)
+}
 
-func Parse() (opts Options, err error) {
-	osArgs := os.Args[1:]
+// Command describes a command
+type Command struct {
+	Name string
+	// Args describes the positional arguments, like [NAME]
+	Args             string
+	MinArgs, MaxArgs int
+	Usage            string
+	// Options are the long names of the options the command takes besides the global ones
+	Options []string
+}
+
+// DefaultCommand is run when no command is given
+const DefaultCommand = "run"
+
+// Global are the long names of the options every command takes
+var Global = []string{"help", "version", "config"}
+
+// Commands are dxhd's commands
+var Commands = []*Command{
+	{Name: "run", Usage: "Listens to the bindings of the config and runs their commands, the default command",
+		Options: []string{"background", "interactive", "display", "name", "record", "notify", "scope", "log-file", "kill", "reload", "dry-run", "edit", "parse-time", "format"}},
+	{Name: "check", Usage: "Parses the config and reports whether it's valid", Options: []string{"parse-time"}},
+	{Name: "list", Usage: "Prints the bindings of the config and their commands", Options: []string{"parse-time", "format"}},
+	{Name: "export", Usage: "Prints the bindings of the config and their descriptions as a cheat sheet", Options: []string{"to", "scripts"}},
+	{Name: "fmt", Args: "[FILE]", MaxArgs: 1, Usage: "Formats the config, or given file, in place", Options: []string{"check"}},
+	{Name: "import", Args: "FORMAT FILE", MinArgs: 2, MaxArgs: 2, Usage: "Converts a config of another hotkey daemon, only sxhkd for now, and prints it"},
+	{Name: "reload", Args: "[NAME]", MaxArgs: 1, Usage: "Reloads the named instance, or every running instance of dxhd"},
+	{Name: "kill", Args: "[NAME]", MaxArgs: 1, Usage: "Gracefully kills the named instance, or every running instance of dxhd"},
+	{Name: "edit", Args: "[FILE]", MaxArgs: 1, Usage: "Edits a file in dxhd's config folder, dxhd.sh by default"},
+	{Name: "keys", Usage: "Grabs the keyboard and prints pressed key combinations in config syntax", Options: []string{"display"}},
+	{Name: "replay", Args: "FILE", MinArgs: 1, MaxArgs: 1, Usage: "Prints which commands the events recorded with --record would run"},
+	{Name: "history", Args: "[BINDING]", MaxArgs: 1, Usage: "Prints the output of the commands run, of every binding or only of given one"},
+	{Name: "completion", Args: "SHELL", MinArgs: 1, MaxArgs: 1, Usage: "Prints the completion script of bash, zsh or fish"},
+	{Name: "lsp", Usage: "Speaks the language server protocol over stdio, for editors to check configs"},
+	{Name: "man", Usage: "Prints the man page of dxhd in roff"},
+	{Name: "help", Args: "[COMMAND]", MaxArgs: 1, Usage: "Prints the help of dxhd or of a command"},
+	{Name: "version", Usage: "Prints current version of program"},
+}
+
+// All are dxhd's options
+var All = []*Option{
+	{Long: "help", Short: 'h', Usage: "Prints this help message",
+		set: func(opts *Options, _ *string) { opts.Help = true }},
+	{Long: "version", Short: 'v', Usage: "Prints current version of program",
+		set: func(opts *Options, _ *string) { opts.Version = true }},
+	{Long: "config", Short: 'c', Arg: "path", Env: "DXHD_CONFIG", Usage: "Reads the config from custom path",
+		set: func(opts *Options, arg *string) { opts.Config = arg }},
+	{Long: "background", Short: 'b', Usage: "Runs dxhd in the background",
+		set: func(opts *Options, _ *string) { opts.Background = true }},
+	{Long: "interactive", Short: 'i', Usage: "Opens a temporary file for temporary bindings to run",
+		set: func(opts *Options, _ *string) { opts.Interactive = true }},
+	{Long: "display", Short: 'x', Arg: "list", Usage: "Serves given comma separated X displays instead of $DISPLAY",
+		set: func(opts *Options, arg *string) {
+			for _, display := range strings.Split(*arg, ",") {
+				if display = strings.TrimSpace(display); display != "" {
+					opts.Displays = append(opts.Displays, display)
+				}
+			}
+		}},
+	{Long: "name", Short: 'n', Arg: "name", Usage: "Names the instance, only one instance of a name can run",
+		set: func(opts *Options, arg *string) { opts.Name = arg }},
+	{Long: "record", Arg: "file", Usage: "Appends every received key and button event to a file, see replay",
+		set: func(opts *Options, arg *string) { opts.Record = arg }},
+	{Long: "notify", Usage: "Shows a desktop notification when a command fails",
+		set: func(opts *Options, _ *string) { opts.Notify = true }},
+	{Long: "scope", Usage: "Runs every command but the ones of drags and hot corners in its own transient systemd scope, so it outlives dxhd's unit",
+		set: func(opts *Options, _ *string) { opts.Scope = true }},
+	{Long: "log-file", Arg: "file", Usage: "Appends the output of dxhd running in the background to a file",
+		set: func(opts *Options, arg *string) { opts.LogFile = arg }},
+	{Long: "parse-time", Short: 'p', Alias: "check", Usage: "Prints how much time parsing a config took",
+		set: func(opts *Options, _ *string) { opts.ParseTime = true }},
+	{Long: "format", Arg: "format", Alias: "list", Usage: "Prints the bindings as text, json or yaml",
+		set: func(opts *Options, arg *string) { opts.Format = *arg }},
+	{Long: "to", Arg: "format", Usage: "Exports to markdown, html, rofi, sxhkd, i3 or xbindkeys, markdown by default",
+		set: func(opts *Options, arg *string) { opts.To = *arg }},
+	{Long: "scripts", Arg: "path", Usage: "Writes the commands other hotkey daemons can't run as they are to scripts in a folder, scripts next to the config by default",
+		set: func(opts *Options, arg *string) { opts.Scripts = arg }},
+	{Long: "check", Usage: "Reports whether the config is formatted instead of formatting it, exits with 1 if it's not",
+		set: func(opts *Options, _ *string) { opts.Check = true }},
+	{Long: "kill", Short: 'k', Arg: "name", Optional: true, Alias: "kill", Usage: "Same as the kill command"},
+	{Long: "reload", Short: 'r', Arg: "name", Optional: true, Alias: "reload", Usage: "Same as the reload command"},
+	{Long: "dry-run", Short: 'd', Alias: "list", Usage: "Same as the list command"},
+	{Long: "edit", Short: 'e', Arg: "file", Optional: true, Alias: "edit", Usage: "Same as the edit command"},
+}
 
-	skip := false
+// FindCommand returns the command of given name, nil if there is none
+func FindCommand(name string) *Command {
+	for _, cmd := range Commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
 
-	readNextArg := func(index int, optional bool) (*string, error) {
-		if index == len(osArgs)-1 || strings.HasPrefix(osArgs[index+1], "-") {
-			if optional {
-				return nil, nil
+// OptionsOf returns the options a command takes, the global ones first
+func OptionsOf(cmd *Command) (opts []*Option) {
+	names := append(append([]string{}, Global...), cmd.Options...)
+	for _, name := range names {
+		for _, opt := range All {
+			if opt.Long == name {
+				opts = append(opts, opt)
 			}
-			return nil, errors.New("not enough arguments passed to flags")
 		}
-		return &osArgs[index+1], nil
 	}
+	return
+}
 
-	for in, osArg := range osArgs {
-		if skip {
-			skip = false
+// takes returns the options a command takes, the default command only takes the aliases if it was not given
+// explicitly, as they run other commands
+func takes(cmd *Command, explicit bool) (opts []*Option) {
+	for _, opt := range OptionsOf(cmd) {
+		if explicit && opt.Alias != "" && cmd.Name == DefaultCommand {
+			// like dxhd run --kill or dxhd run --format json
 			continue
 		}
-		if strings.HasPrefix(osArg, "--") {
-			switch opt := osArg[2:]; {
-			case opt == "help":
-				opts.Help = true
-			case opt == "kill":
-				opts.Kill = true
-			case opt == "reload":
-				opts.Reload = true
-			case opt == "dry-run":
-				opts.DryRun = true
-			case opt == "parse-time":
-				opts.ParseTime = true
-			case opt == "background":
-				opts.Background = true
-				os.Args[1+in] = "" // remove --background
-			case opt == "config":
-				opts.Config, err = readNextArg(in, false)
-				if err != nil {
-					break
+		opts = append(opts, opt)
+	}
+	return
+}
+
+// appliesTo reports whether an option given does something for a command, either as its option or as the alias
+// which runs it
+func appliesTo(opt *Option, cmd *Command) bool {
+	if opt.Alias == cmd.Name {
+		return true
+	}
+	for _, o := range OptionsOf(cmd) {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandsToPrint returns the list of commands for the help message
+func CommandsToPrint() string {
+	var b strings.Builder
+	for _, cmd := range Commands {
+		fmt.Fprintf(&b, "\n  %-24s%s", strings.TrimSpace(cmd.Name+" "+cmd.Args), cmd.Usage)
+	}
+	return b.String()
+}
+
+// OptionsToPrint returns the list of the options of a command for the help message
+func OptionsToPrint(cmd *Command) string {
+	var b strings.Builder
+	for _, opt := range OptionsOf(cmd) {
+		flags := "    --" + opt.Long
+		if opt.Short != 0 {
+			flags = fmt.Sprintf("-%c, --%s", opt.Short, opt.Long)
+		}
+		if opt.Arg != "" {
+			flags += " [" + opt.Arg + "]"
+		}
+		usage := opt.Usage
+		if opt.Env != "" {
+			usage += ", $" + opt.Env + " by default"
+		}
+		fmt.Fprintf(&b, "\n  %-24s%s", flags, usage)
+	}
+	return b.String()
+}
+
+// CommandUsage returns the help message of a command
+func CommandUsage(cmd *Command) string {
+	return fmt.Sprintf("USAGE\n  dxhd %s [OPTIONS]\nDESCRIPTION\n  %s\nOPTIONS%s",
+		strings.TrimSpace(cmd.Name+" "+cmd.Args), cmd.Usage, OptionsToPrint(cmd))
+}
+
+// Parse parses the command line
+func Parse() (opts Options, err error) {
+	return ParseArgs(os.Args[1:])
+}
+
+// ParseArgs parses given arguments, the program name excluded
+func ParseArgs(args []string) (opts Options, err error) {
+	cmd := FindCommand(DefaultCommand)
+	// aliases of the old flags only apply when no command is given
+	explicit := false
+	if len(args) > 0 {
+		if c := FindCommand(args[0]); c != nil {
+			cmd, explicit = c, true
+			args = args[1:]
+		}
+	}
+	opts.Command = cmd.Name
+
+	accepted := make(map[string]*Option)
+	for _, opt := range takes(cmd, explicit) {
+		accepted[opt.Long] = opt
+		if opt.Short != 0 {
+			accepted[string(opt.Short)] = opt
+		}
+	}
+
+	// options are set once the command is known, an alias given after them may still switch it
+	type setting struct {
+		opt *Option
+		arg *string
+	}
+	var settings []setting
+	given := make(map[*Option]bool)
+	apply := func(opt *Option, arg *string) {
+		given[opt] = true
+		if opt.Alias != "" && !explicit && opts.Command == DefaultCommand {
+			opts.Command = opt.Alias
+			if arg != nil && opt.set == nil {
+				opts.Args = append(opts.Args, *arg)
+			}
+		}
+		if opt.set != nil {
+			settings = append(settings, setting{opt, arg})
+		}
+	}
+
+	// takeArg reads the argument of an option from the next argument, if the option has one
+	takeArg := func(opt *Option, name string, i *int) (arg *string, err error) {
+		if opt.Arg == "" {
+			return
+		}
+		if *i+1 < len(args) && (!opt.Optional || !strings.HasPrefix(args[*i+1], "-")) {
+			*i++
+			return &args[*i], nil
+		}
+		if !opt.Optional {
+			err = fmt.Errorf("%s requires an argument", name)
+		}
+		return
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			opts.Args = append(opts.Args, args[i+1:]...)
+			i = len(args)
+		case strings.HasPrefix(arg, "--"):
+			name, value, hasValue := arg[2:], "", false
+			if eq := strings.Index(name, "="); eq >= 0 {
+				name, value, hasValue = name[:eq], name[eq+1:], true
+			}
+			opt, ok := accepted[name]
+			if !ok || len(name) == 1 {
+				return opts, fmt.Errorf("--%s is not a valid option of %s", name, cmd.Name)
+			}
+			var optArg *string
+			switch {
+			case hasValue && opt.Arg == "":
+				return opts, fmt.Errorf("--%s does not take an argument", name)
+			case hasValue && value == "":
+				return opts, fmt.Errorf("--%s requires an argument", name)
+			case hasValue:
+				optArg = &value
+			default:
+				if optArg, err = takeArg(opt, "--"+name, &i); err != nil {
+					return
 				}
-				skip = true
-			case strings.HasPrefix(opt, "config="):
-				opts.Config = new(string)
-				*opts.Config = strings.TrimPrefix(opt, "config=")
-			case opt == "version":
-				opts.Version = true
-			case opt == "interactive":
-				opts.Interactive = true
-			case opt == "edit":
-				opts.Edit, err = readNextArg(in, true)
-				if err != nil {
-					continue
+			}
+			apply(opt, optArg)
+		case strings.HasPrefix(arg, "-") && arg != "-":
+			// combined short options, the first one taking an argument takes the rest of them or the next argument
+			shorts := []rune(arg[1:])
+			for j, r := range shorts {
+				opt, ok := accepted[string(r)]
+				if !ok {
+					return opts, fmt.Errorf("-%c in %s is not a valid option of %s", r, arg, cmd.Name)
 				}
-				if opts.Edit == nil {
-					// Default value if --edit is given but no argument
-					// This allows to differentiate between no edit flag
-					// and wanting to edit the default config
-					opts.Edit = new(string)
-					*opts.Edit = ""
-				} else {
-					skip = true
+				if opt.Arg != "" && j+1 < len(shorts) {
+					rest := string(shorts[j+1:])
+					apply(opt, &rest)
+					break
 				}
-			case strings.HasPrefix(opt, "edit="):
-				opts.Edit = new(string)
-				*opts.Edit = strings.TrimPrefix(opt, "edit=")
-			default:
-				err = fmt.Errorf("%s is not a valid option", osArg)
-				return
-			}
-		} else if strings.HasPrefix(osArg, "-") {
-			for i, r := range osArg[1:] {
-				switch string(r) {
-				case "h":
-					opts.Help = true
-				case "k":
-					opts.Kill = true
-				case "r":
-					opts.Reload = true
-				case "v":
-					opts.Version = true
-				case "d":
-					opts.DryRun = true
-				case "p":
-					opts.ParseTime = true
-				case "b":
-					opts.Background = true
-					if len(osArg) == 2 { // means b is the only flag with dash prefix
-						os.Args[1+in] = ""
-					} else { // means it's a flag combo
-						os.Args[1+in] = os.Args[1+in][0:1+i] + os.Args[1+in][2+i:] // remove b from the combo
-					}
-				case "c":
-					opts.Config, err = readNextArg(in, false)
-					if err != nil {
-						continue
-					}
-					skip = true
-				case "e":
-					opts.Edit, err = readNextArg(in, true)
-					if err != nil {
-						continue
-					}
-					if opts.Edit == nil {
-						// Default value if -e is given but no argument
-						// This allows to differentiate between no edit flag
-						// and wanting to edit the default config
-						opts.Edit = new(string)
-						*opts.Edit = ""
-					} else {
-						skip = true
-					}
-				case "i":
-					opts.Interactive = true
-				default:
-					err = fmt.Errorf("%s in %s is not a valid option", string(r), osArg)
+				var optArg *string
+				if optArg, err = takeArg(opt, "-"+string(r), &i); err != nil {
 					return
 				}
+				apply(opt, optArg)
 			}
+		default:
+			opts.Args = append(opts.Args, arg)
+		}
+	}
+
+	// the old flags could be combined freely, the options which do nothing for the command they ran are ignored
+	cmd = FindCommand(opts.Command)
+	for _, opt := range All {
+		if given[opt] && !appliesTo(opt, cmd) {
+			opts.Ignored = append(opts.Ignored, opt.Long)
 		}
 	}
+	for _, s := range settings {
+		if appliesTo(s.opt, cmd) {
+			s.opt.set(&opts, s.arg)
+		}
+	}
+
+	for _, opt := range OptionsOf(cmd) {
+		if env := os.Getenv(opt.Env); opt.Env != "" && env != "" && !given[opt] {
+			opt.set(&opts, &env)
+		}
+	}
+
+	if opts.Help || opts.Version {
+		return
+	}
+
+	switch {
+	case len(opts.Args) < cmd.MinArgs:
+		err = fmt.Errorf("%s requires %s", cmd.Name, cmd.Args)
+	case len(opts.Args) > 0 && !explicit && cmd.Name == DefaultCommand:
+		err = fmt.Errorf("%s is not a command of dxhd", opts.Args[0])
+	case len(opts.Args) > cmd.MaxArgs && cmd.MaxArgs == 0:
+		err = fmt.Errorf("%s takes no arguments, %q was given", cmd.Name, opts.Args[0])
+	case len(opts.Args) > cmd.MaxArgs:
+		err = errors.New(cmd.Name + " takes too many arguments")
+	}
 
 	return
 }
@@ -0,0 +1,141 @@
+package options_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/options"
+)
+
+func TestParseArgs(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		args []string
+		want options.Options
+	}{
+		{nil, options.Options{Command: "run"}},
+		{[]string{"-bc", "dxhd.sh"}, options.Options{Command: "run", Background: true, Config: str("dxhd.sh")}},
+		{[]string{"-cdxhd.sh", "-b"}, options.Options{Command: "run", Background: true, Config: str("dxhd.sh")}},
+		{[]string{"--config=dxhd.sh", "-x", ":0,:1"}, options.Options{Command: "run", Config: str("dxhd.sh"), Displays: []string{":0", ":1"}}},
+		{[]string{"run", "--name", "work", "--notify"}, options.Options{Command: "run", Name: str("work"), Notify: true}},
+		{[]string{"kill", "work"}, options.Options{Command: "kill", Args: []string{"work"}}},
+		{[]string{"reload", "--", "-odd"}, options.Options{Command: "reload", Args: []string{"-odd"}}},
+		{[]string{"list", "-p"}, options.Options{Command: "list", ParseTime: true}},
+		{[]string{"help", "kill"}, options.Options{Command: "help", Args: []string{"kill"}}},
+		{[]string{"kill", "-h"}, options.Options{Command: "kill", Help: true}},
+
+		// the flags from before dxhd had commands
+		{[]string{"-k"}, options.Options{Command: "kill"}},
+		{[]string{"-k", "work"}, options.Options{Command: "kill", Args: []string{"work"}}},
+		{[]string{"--reload=work"}, options.Options{Command: "reload", Args: []string{"work"}}},
+		{[]string{"-d", "-c", "dxhd.sh"}, options.Options{Command: "list", Config: str("dxhd.sh")}},
+		{[]string{"-p"}, options.Options{Command: "check", ParseTime: true}},
+		{[]string{"-d", "--format=json"}, options.Options{Command: "list", Format: "json"}},
+		{[]string{"--format", "yaml"}, options.Options{Command: "list", Format: "yaml"}},
+		{[]string{"-e"}, options.Options{Command: "edit"}},
+		{[]string{"--edit", "i3.py"}, options.Options{Command: "edit", Args: []string{"i3.py"}}},
+		// the options which do nothing for the command the old flags run are ignored
+		{[]string{"-p", "-d"}, options.Options{Command: "check", ParseTime: true, Ignored: []string{"dry-run"}}},
+		{[]string{"--format", "json", "-b"}, options.Options{Command: "list", Format: "json", Ignored: []string{"background"}}},
+		{[]string{"-b", "-k"}, options.Options{Command: "kill", Ignored: []string{"background"}}},
+	}
+
+	for _, test := range tests {
+		got, err := options.ParseArgs(test.args)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: expected %+v, got %+v", test.args, test.want, got)
+		}
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := [][]string{
+		{"--nope"},
+		{"-z"},
+		{"--config"},
+		{"--config="},
+		{"--notify=yes"},
+		{"keys", "--notify"},
+		{"replay"},
+		{"kill", "a", "b"},
+		{"run", "-k"},
+		{"run", "--format", "json"},
+		{"run", "-p"},
+		{"stray"},
+	}
+
+	for _, args := range tests {
+		if _, err := options.ParseArgs(args); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
+
+func TestParseArgsEnv(t *testing.T) {
+	os.Setenv("DXHD_CONFIG", "env.sh")
+	defer os.Unsetenv("DXHD_CONFIG")
+
+	opts, err := options.ParseArgs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Config == nil || *opts.Config != "env.sh" {
+		t.Fatalf("expected the config from $DXHD_CONFIG, got %v", opts.Config)
+	}
+
+	if opts, err = options.ParseArgs([]string{"-c", "flag.sh"}); err != nil || *opts.Config != "flag.sh" {
+		t.Fatalf("expected the flag to win over $DXHD_CONFIG, got %v, %v", *opts.Config, err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range options.Shells {
+		var b strings.Builder
+		if err := options.Completion(&b, shell); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		for _, cmd := range options.Commands {
+			if !strings.Contains(b.String(), cmd.Name) {
+				t.Errorf("%s: %s is not completed", shell, cmd.Name)
+			}
+		}
+		for _, opt := range options.All {
+			if !strings.Contains(b.String(), opt.Long) {
+				t.Errorf("%s: --%s is not completed", shell, opt.Long)
+			}
+		}
+	}
+
+	if err := options.Completion(ioutil.Discard, "tcsh"); err == nil {
+		t.Error("expected an error for an unsupported shell")
+	}
+}
+
+func TestManual(t *testing.T) {
+	var b strings.Builder
+	if err := options.Manual(&b, "1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	man := b.String()
+	if !strings.HasPrefix(man, `.TH DXHD 1 "" "dxhd 1.0.0"`) {
+		t.Errorf("unexpected header %q", man[:strings.Index(man, "\n")])
+	}
+	for _, opt := range options.All {
+		if !strings.Contains(man, `\fB\-\-`+strings.ReplaceAll(opt.Long, "-", `\-`)+`\fR`) {
+			t.Errorf("--%s is not documented", opt.Long)
+		}
+	}
+	for _, line := range strings.Split(man, "\n") {
+		if strings.HasPrefix(line, "'") {
+			t.Errorf("%q would be read as a request", line)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package options
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the texts of the help message and the manual besides the commands and options
+const (
+	Summary     = "daky's X11 Hotkey Daemon"
+	Description = "dxhd is an easy-to-use X11 hotkey daemon, written in Go programming language, and inspired by sxhkd.\n" +
+		"More can be read here - https://github.com/dakyskye/dxhd#readme"
+	ExampleConfig = `#!/usr/bin/bash
+## restart i3
+# super + shift + r
+i3-msg -t command restart
+## switch to workspace 1-10
+# super + @{1-9,0}
+i3-msg -t command workspace {1-9,10}
+## switch to workspace 11-20
+# super + ctrl + {1-9,0}
+i3-msg -t command workspace {11-19,20}
+## switch to next/prev workspace
+# super + @mouse{4,5}
+i3-msg -t command workspace {next,prev}`
+	Bugs   = "report a bug here if you find one - https://github.com/dakyskye/dxhd/issues"
+	Author = "Lasha Kanteladze <kanteladzelasha339@gmail.com>"
+)
+
+// indent indents every line of s by two spaces
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
+
+// Usage returns the help message of dxhd
+func Usage(version string) string {
+	return fmt.Sprintf(`NAME
+  dxhd - %s
+VERSION
+  %s
+SYNOPSIS
+  dxhd [OPTIONS]
+  dxhd COMMAND [ARGS] [OPTIONS]
+  dxhd help COMMAND
+DESCRIPTION
+%s
+COMMANDS%s
+OPTIONS%s
+EXAMPLE CONFIG
+%s
+BUGS
+  %s
+AUTHOR
+  %s`, Summary, version, indent(Description), CommandsToPrint(), OptionsToPrint(FindCommand(DefaultCommand)), indent(ExampleConfig), Bugs, Author)
+}
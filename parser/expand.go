@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// variants is a text with variant groups in it, like a binding or a command
+type variants struct {
+	// parts are the text around the groups, there is one more part than there are groups
+	parts  []string
+	groups []Group
+}
+
+// add appends a text starting at offset in the config, along with its groups
+func (v *variants) add(text string, offset int, groups []Group) {
+	if len(v.parts) == 0 {
+		v.parts = []string{""}
+	}
+	at := 0
+	for _, g := range groups {
+		v.parts[len(v.parts)-1] += text[at : g.Start-offset]
+		v.groups = append(v.groups, g)
+		v.parts = append(v.parts, "")
+		at = g.End - offset
+	}
+	v.parts[len(v.parts)-1] += text[at:]
+}
+
+// String returns the text with its groups unexpanded
+func (v *variants) String() string {
+	var b strings.Builder
+	for i, part := range v.parts {
+		if i > 0 {
+			b.WriteString(v.groups[i-1].Text)
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// bindingVariants returns the variants of a binding line, without spaces
+func bindingVariants(b *BindingLine) (v variants) {
+	for i, key := range b.Keys {
+		if i > 0 {
+			v.add("+", -1, nil)
+		}
+		v.add(key.Text, key.Start, key.Groups)
+	}
+	for i := range v.parts {
+		v.parts[i] = strings.ReplaceAll(v.parts[i], " ", "")
+	}
+	return
+}
+
+// bodyVariants returns the variants of a command, its lines joined by line breaks
+func bodyVariants(body Body) (v variants) {
+	groups := body.Groups
+	for i, line := range body.Lines {
+		if i > 0 {
+			v.add("\n", -1, nil)
+		}
+		n := 0
+		for n < len(groups) && groups[n].Start < line.End {
+			n++
+		}
+		v.add(line.Text, line.Start, groups[:n])
+		groups = groups[n:]
+	}
+	return
+}
+
+// values returns every value of a range, numbers are counted, letters are stepped through
+func (r *Range) values() (values []string) {
+	from, fromErr := strconv.Atoi(r.From)
+	to, toErr := strconv.Atoi(r.To)
+	if fromErr == nil && toErr == nil {
+		for i := from; i <= to; i++ {
+			values = append(values, strconv.Itoa(i))
+		}
+		return
+	}
+	for c := []rune(r.From)[0]; c <= []rune(r.To)[0]; c++ {
+		values = append(values, string(c))
+	}
+	return
+}
+
+// blank returns the member an underscore stands for, which is none
+func blank(member string) string {
+	if member == "_" {
+		return ""
+	}
+	return member
+}
+
+// pair returns the members of a binding group and the ones of the group paired with it, ranges expanded,
+// a binding group paired with none leaves the other text as it is
+func pair(b Group, other *Group) (bindings, others []string, err error) {
+	if other != nil && len(other.Members) != len(b.Members) {
+		err = errors.New("the amounts of variant members in a keybinding and its command do not match")
+		return
+	}
+	for i, member := range b.Members {
+		var o *Member
+		if other != nil {
+			o = &other.Members[i]
+		}
+		if member.Range == nil {
+			bindings = append(bindings, blank(strings.ReplaceAll(member.Text, " ", "")))
+			if o != nil {
+				others = append(others, blank(o.Text))
+			} else {
+				others = append(others, "")
+			}
+			continue
+		}
+
+		values := member.Range.values()
+		if len(values) < 2 {
+			err = fmt.Errorf("invalid range %s-%s", member.Range.From, member.Range.To)
+			return
+		}
+		bindings = append(bindings, values...)
+		switch {
+		case o == nil || o.Text == "_":
+			others = append(others, make([]string, len(values))...)
+		case o.Range == nil:
+			err = errors.New("the indexes of ranges for a keybinding and its command do not match")
+			return
+		default:
+			// 1-9 and 11-19 do match, so do 4-8 and a-e
+			otherValues := o.Range.values()
+			if len(otherValues) != len(values) {
+				err = errors.New("the ranges of a keybinding and its command do not match")
+				return
+			}
+			others = append(others, otherValues...)
+		}
+	}
+	return
+}
+
+// members pairs every group of a binding with the group of other at the same index
+func members(binding, other *variants) (bindings, others [][]string, err error) {
+	if len(other.groups) > len(binding.groups) {
+		err = errors.New("a command has more variants than its binding")
+		return
+	}
+	bindings, others = make([][]string, len(binding.groups)), make([][]string, len(binding.groups))
+	for i, g := range binding.groups {
+		var o *Group
+		if i < len(other.groups) {
+			o = &other.groups[i]
+		}
+		bindings[i], others[i], err = pair(g, o)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// expansion is a binding with its variants replaced by members, along with its command and description
+type expansion struct {
+	binding, command, description string
+}
+
+// expand replicates a binding for every combination of its variant members, in the order they are written,
+// a binding which is already replicated is skipped, a description which can not be expanded is kept as it is
+func expand(binding, command, description variants) (expanded []expansion, err error) {
+	// braces of a command are not variants unless its binding has some
+	if len(binding.groups) == 0 {
+		expanded = append(expanded, expansion{binding: binding.String(), command: command.String(), description: description.String()})
+		return
+	}
+
+	bindings, commands, err := members(&binding, &command)
+	if err != nil {
+		return
+	}
+	_, descriptions, e := members(&binding, &description)
+	expandDescription := e == nil && len(description.groups) > 0
+
+	// build joins the parts of v with the members at index
+	build := func(v *variants, members [][]string, index []int) string {
+		var b strings.Builder
+		for i, part := range v.parts {
+			if i > 0 {
+				b.WriteString(members[i-1][index[i-1]])
+			}
+			b.WriteString(part)
+		}
+		return b.String()
+	}
+
+	seen := make(map[string]bool)
+	index := make([]int, len(bindings))
+	for {
+		// we get ++ when we replace underscore literal with nothing
+		b := build(&binding, bindings, index)
+		for strings.Contains(b, "++") {
+			b = strings.ReplaceAll(b, "++", "+")
+		}
+		b = strings.Trim(b, "+")
+
+		if !seen[b] {
+			seen[b] = true
+			e := expansion{binding: b, command: build(&command, commands, index), description: description.String()}
+			if expandDescription {
+				e.description = build(&description, descriptions, index)
+			}
+			expanded = append(expanded, e)
+		}
+
+		// step to the next combination, the last group first
+		i := len(index) - 1
+		for ; i >= 0; i-- {
+			index[i]++
+			if index[i] < len(bindings[i]) {
+				break
+			}
+			index[i] = 0
+		}
+		if i < 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+)
+
+// modifierOrder is the order modifiers are formatted in, the same dxhd keys prints them in
+var modifierOrder = map[string]int{"super": 1, "ctrl": 2, "alt": 3, "shift": 4, "mod3": 5, "mod5": 6, "mod2": 7, "lock": 8}
+
+// canonicalKeys are the names keys are formatted with, by their lowercase names
+var canonicalKeys = map[string]string{
+	"mod4": "super", "control": "ctrl", "mod1": "alt",
+	"super": "super", "ctrl": "ctrl", "alt": "alt", "shift": "shift", "mod2": "mod2", "mod3": "mod3", "mod5": "mod5", "lock": "lock",
+	"return": "Return", "escape": "Escape", "tab": "Tab", "backspace": "BackSpace", "delete": "Delete", "insert": "Insert",
+	"home": "Home", "end": "End", "prior": "Prior", "next": "Next", "page_up": "Page_Up", "page_down": "Page_Down",
+	"left": "Left", "right": "Right", "up": "Up", "down": "Down", "print": "Print", "pause": "Pause", "menu": "Menu",
+	"caps_lock": "Caps_Lock", "num_lock": "Num_Lock", "scroll_lock": "Scroll_Lock", "space": "space",
+}
+
+// canonicalKey returns the canonical name of a key without variants
+func canonicalKey(key string) string {
+	if name, ok := canonicalKeys[strings.ToLower(key)]; ok {
+		return name
+	}
+	// function keys
+	if len(key) > 1 && (key[0] == 'f' || key[0] == 'F') && strings.Trim(key[1:], "0123456789") == "" {
+		return "F" + key[1:]
+	}
+	return key
+}
+
+// formatKey formats a key of a binding, the members of its variant groups formatted like bindings themselves
+func formatKey(key string) string {
+	if !strings.ContainsAny(key, "{}") {
+		prefix := key[:len(key)-len(strings.TrimLeft(key, "@!"))]
+		return prefix + canonicalKey(key[len(prefix):])
+	}
+
+	var b strings.Builder
+	for len(key) > 0 {
+		open := strings.IndexByte(key, '{')
+		end := strings.IndexByte(key, '}')
+		if open < 0 || end < open {
+			b.WriteString(key)
+			break
+		}
+		b.WriteString(key[:open+1])
+		members := strings.Split(key[open+1:end], ",")
+		for i, member := range members {
+			parts := strings.Split(member, "+")
+			for j, part := range parts {
+				if part = strings.TrimSpace(part); part != "_" && !bindingRangePattern.MatchString(part) {
+					part = formatKey(part)
+				}
+				parts[j] = part
+			}
+			// a member like "shift +" is joined to the key after the group, it keeps no space before it
+			members[i] = strings.TrimSpace(strings.Join(parts, " + "))
+		}
+		b.WriteString(strings.Join(members, ",") + "}")
+		key = key[end+1:]
+	}
+	return b.String()
+}
+
+// FormatBinding formats a binding line as # super + shift + a, with its modifiers first in a fixed order
+func FormatBinding(b *BindingLine) string {
+	keys := make([]string, len(b.Keys))
+	for i, key := range b.Keys {
+		keys[i] = formatKey(key.Text)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return modifierRank(keys[i]) < modifierRank(keys[j])
+	})
+
+	line := "# "
+	if b.Device != nil {
+		line += b.Device.Text + " "
+	}
+	return line + strings.Join(keys, " + ")
+}
+
+// modifierRank returns the place of a modifier, every other key comes after the modifiers
+func modifierRank(key string) int {
+	if rank, ok := modifierOrder[key]; ok {
+		return rank
+	}
+	return len(modifierOrder) + 1
+}
+
+// Format returns the formatted config of a tree: binding lines are formatted, trailing spaces of other lines than
+// commands trimmed, and blocks, the shebang, the globals, and comments and bindings along with their commands,
+// separated by single blank lines, lines of spaces are kept in commands, like the ones of heredocs
+func Format(t *Tree) []byte {
+	var b strings.Builder
+	var prev *Node
+	blank, bound := false, false
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		if n.Kind == NodeBinding {
+			bound = true
+		}
+		// commands are run as they are written, a command above every binding is run by none
+		if n.Kind == NodeBlank || strings.TrimSpace(n.Text) == "" && (n.Kind != NodeCommand || !bound) {
+			blank = true
+			continue
+		}
+
+		if prev != nil {
+			separate := blank
+			switch {
+			case prev.Kind == NodeShebang:
+				separate = true
+			// the parser skips blank lines, a command goes on until the next binding
+			case n.Kind == NodeCommand && (prev.Kind == NodeBinding || prev.Kind == NodeCommand):
+				separate = false
+			case n.Kind == NodeBinding && prev.Kind == NodeBinding:
+				separate = false
+			case (prev.Kind == NodeCommand || prev.Kind == NodeGlobal) && (n.Kind == NodeComment || n.Kind == NodeBinding):
+				separate = true
+			}
+			if separate {
+				b.WriteString("\n")
+			}
+		}
+		prev, blank = n, false
+
+		switch n.Kind {
+		case NodeBinding:
+			b.WriteString(FormatBinding(n.Binding))
+		case NodeCommand, NodeGlobal:
+			b.WriteString(n.Text)
+		default:
+			b.WriteString(strings.TrimRight(n.Text, " \t"))
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
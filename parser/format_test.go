@@ -0,0 +1,140 @@
+package parser_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+const unformatted = `#!/bin/sh
+foo=1
+
+
+bar=2
+## restart   
+#shift+super+r
+i3-msg restart
+
+
+## switch
+#  ctrl +mod4 + {1-9,0}
+i3-msg workspace {1-9,10}
+#super+{_,shift +}Return
+
+echo {a,b}
+
+echo b
+## standalone comment
+
+## describes
+# [device="My Pad"]   mouse1 +Control
+echo pad
+#alt+@f5
+true`
+
+const formatted = `#!/bin/sh
+
+foo=1
+
+bar=2
+
+## restart
+# super + shift + r
+i3-msg restart
+
+## switch
+# super + ctrl + {1-9,0}
+i3-msg workspace {1-9,10}
+
+# super + {_,shift +}Return
+echo {a,b}
+echo b
+
+## standalone comment
+
+## describes
+# [device="My Pad"] ctrl + mouse1
+echo pad
+
+# alt + @F5
+true
+`
+
+func TestParseTreeIsLossless(t *testing.T) {
+	for _, src := range []string{unformatted, formatted, "", "\n", "#!/bin/sh"} {
+		if got := parser.ParseTree([]byte(src)).String(); got != src {
+			t.Errorf("expected %q, got %q", src, got)
+		}
+	}
+
+	tree := parser.ParseTree([]byte(unformatted))
+	n := tree.Nodes[21]
+	if n.Kind != parser.NodeBinding || n.Line != 22 || n.Binding.Device.Text != `[device="My Pad"]` {
+		t.Fatalf("unexpected node %+v", n)
+	}
+	for _, key := range n.Binding.Keys {
+		if unformatted[key.Start:key.End] != key.Text {
+			t.Errorf("%q is not at %d-%d", key.Text, key.Start, key.End)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := string(parser.Format(parser.ParseTree([]byte(unformatted))))
+	if got != formatted {
+		t.Fatalf("expected\n%s\ngot\n%s", formatted, got)
+	}
+	if again := string(parser.Format(parser.ParseTree([]byte(got)))); again != got {
+		t.Errorf("formatting is not idempotent, got\n%s", again)
+	}
+
+	// formatting does not change what the config means, keys are looked up regardless of their case
+	parse := func(src string) (expanded []parser.Expanded) {
+		var data []parser.FileData
+		shell, _, err := parser.Parse([]byte(src), &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range parser.Expand(shell, data) {
+			keys := strings.Split(strings.ToLower(e.Translated), "-")
+			sort.Strings(keys)
+			e.Binding, e.Translated, e.Line = "", strings.Join(keys, "-"), 0
+			expanded = append(expanded, e)
+		}
+		return
+	}
+	before, after := parse(unformatted), parse(formatted)
+	if len(before) != len(after) {
+		t.Fatalf("expected %d bindings, got %d", len(before), len(after))
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("expected %+v, got %+v", before[i], after[i])
+		}
+	}
+}
+
+func TestFormatKeepsSpacesOfCommands(t *testing.T) {
+	config := "#!/bin/sh\n## heredoc\n  \n# super+a\ncat <<EOF | xmessage -file -\nfirst\n  \nsecond\nEOF\n"
+	want := "#!/bin/sh\n\n## heredoc\n\n# super + a\ncat <<EOF | xmessage -file -\nfirst\n  \nsecond\nEOF\n"
+	if got := string(parser.Format(parser.ParseTree([]byte(config)))); got != want {
+		t.Fatalf("expected\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestFormatVariants(t *testing.T) {
+	tests := map[string]string{
+		"#super+{_,shift +}Return":     "# super + {_,shift +}Return",
+		"#super+{_, shift+ ctrl +  }a": "# super + {_,shift + ctrl +}a",
+		"#{alt ,super}+{h,  l}":        "# {alt,super} + {h,l}",
+		"#super + {_,shift + }{1-9}":   "# super + {_,shift +}{1-9}",
+	}
+	for binding, want := range tests {
+		config := "#!/bin/sh\n" + binding + "\ntrue\n"
+		if got := string(parser.Format(parser.ParseTree([]byte(config)))); got != "#!/bin/sh\n\n"+want+"\ntrue\n" {
+			t.Errorf("%q: expected %q, got %q", binding, want, got)
+		}
+	}
+}
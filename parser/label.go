@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pretty returns a binding the way it is written in a config, like super + shift + a
+func Pretty(binding string) string {
+	return strings.ReplaceAll(binding, "+", " + ")
+}
+
+// Label returns a binding for people to read, with the device it is bound to if any
+func Label(binding, device string) string {
+	if device != "" {
+		return fmt.Sprintf("%s [%s]", Pretty(binding), device)
+	}
+	return Pretty(binding)
+}
+
+// Summary returns the description of a binding, or the first line of its command if it has none
+func Summary(description, command string) string {
+	if description != "" {
+		return description
+	}
+	command = strings.TrimSpace(command)
+	if i := strings.Index(command, "\n"); i >= 0 {
+		command = command[:i] + " ..."
+	}
+	return command
+}
+
+// Align returns a line of each label and its summary, the summaries aligned for menus like rofi and dmenu to show
+func Align(labels, summaries []string) (lines []string) {
+	width := 0
+	for _, label := range labels {
+		if len(label) > width {
+			width = len(label)
+		}
+	}
+	for i, label := range labels {
+		lines = append(lines, fmt.Sprintf("%-*s  %s", width, label, summaries[i]))
+	}
+	return
+}
+
+// Lines returns the aligned label and summary of each binding
+func Lines(data []FileData) []string {
+	var labels, summaries []string
+	for i := range data {
+		labels = append(labels, Label(data[i].OriginalBinding, data[i].Device))
+		summaries = append(summaries, Summary(data[i].Description, data[i].Command.String()))
+	}
+	return Align(labels, summaries)
+}
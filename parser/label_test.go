@@ -0,0 +1,21 @@
+package parser_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+func TestAlign(t *testing.T) {
+	labels := []string{parser.Label("super+a", ""), parser.Label("a", "Razer Tartarus")}
+	summaries := []string{parser.Summary("open a terminal", "alacritty"), parser.Summary("", "\n  echo a\n  echo b\n")}
+
+	want := []string{
+		"super + a           open a terminal",
+		"a [Razer Tartarus]  echo a ...",
+	}
+	if got := parser.Align(labels, summaries); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
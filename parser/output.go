@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats are the formats Write can print the parsed data in
+var Formats = []string{"text", "json", "yaml"}
+
+// Expanded is a binding of the config after its variants and ranges are expanded
+type Expanded struct {
+	Binding    string `json:"binding"`
+	Translated string `json:"translated"`
+	Event      string `json:"event"`
+	Device     string `json:"device,omitempty"`
+	Line       int    `json:"line"`
+	Shell      string `json:"shell"`
+	Command    string `json:"command"`
+	// Description is the ## comment above the binding, with its variants expanded
+	Description string `json:"description,omitempty"`
+}
+
+// Expand returns the parsed data as Expanded bindings run by given shell
+func Expand(shell string, data []FileData) (expanded []Expanded) {
+	expanded = []Expanded{}
+	for _, d := range data {
+		expanded = append(expanded, Expanded{
+			Binding:     d.OriginalBinding,
+			Translated:  d.Binding.String(),
+			Event:       d.EvtType.String(),
+			Device:      d.Device,
+			Line:        d.Line,
+			Shell:       shell,
+			Command:     d.Command.String(),
+			Description: d.Description,
+		})
+	}
+	return
+}
+
+// Write prints the parsed data to w in given format
+func Write(w io.Writer, format, shell string, data []FileData) (err error) {
+	expanded := Expand(shell, data)
+
+	switch format {
+	case "", "text":
+		var b strings.Builder
+		b.WriteString("dxhd dry run\n")
+		for _, e := range expanded {
+			fmt.Fprintf(&b, "binding: %s\ncommand:\n%s\n", e.Binding, e.Command)
+		}
+		b.WriteString("\n")
+		_, err = io.WriteString(w, b.String())
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(expanded)
+	case "yaml":
+		_, err = io.WriteString(w, yaml(expanded))
+	default:
+		err = fmt.Errorf("%s is not a format, use one of %s", format, strings.Join(Formats, ", "))
+	}
+	return
+}
+
+// yaml returns the expanded bindings as a YAML sequence, double quoted scalars escape the same way Go strings do
+func yaml(expanded []Expanded) string {
+	if len(expanded) == 0 {
+		return "[]\n"
+	}
+	var b strings.Builder
+	for _, e := range expanded {
+		fmt.Fprintf(&b, "- binding: %s\n  translated: %s\n  event: %s\n",
+			strconv.Quote(e.Binding), strconv.Quote(e.Translated), e.Event)
+		if e.Device != "" {
+			fmt.Fprintf(&b, "  device: %s\n", strconv.Quote(e.Device))
+		}
+		fmt.Fprintf(&b, "  line: %d\n  shell: %s\n  command: %s\n", e.Line, strconv.Quote(e.Shell), strconv.Quote(e.Command))
+		if e.Description != "" {
+			fmt.Fprintf(&b, "  description: %s\n", strconv.Quote(e.Description))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package parser_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+const config = `#!/bin/sh
+## switch to workspace {one,two}
+# super + {1,2}
+echo {one,two}
+
+# [device="Pad"] mouse1
+printf "a\tb"
+`
+
+func TestWrite(t *testing.T) {
+	var data []parser.FileData
+	shell, _, err := parser.Parse([]byte(config), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err = parser.Write(&b, "json", shell, data); err != nil {
+		t.Fatal(err)
+	}
+	var got []parser.Expanded
+	if err = json.Unmarshal([]byte(b.String()), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []parser.Expanded{
+		{Binding: "super+1", Translated: "mod4-1", Event: "key-press", Line: 3, Shell: "/bin/sh", Command: "echo one", Description: "switch to workspace one"},
+		{Binding: "super+2", Translated: "mod4-2", Event: "key-press", Line: 3, Shell: "/bin/sh", Command: "echo two", Description: "switch to workspace two"},
+		{Binding: "mouse1", Translated: "1", Event: "button-press", Device: "Pad", Line: 6, Shell: "/bin/sh", Command: `printf "a\tb"`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d bindings, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], got[i])
+		}
+	}
+
+	b.Reset()
+	if err = parser.Write(&b, "yaml", shell, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`- binding: "mouse1"`, `  device: "Pad"`, `  line: 6`, `  command: "printf \"a\\tb\""`} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("expected %s in\n%s", line, b.String())
+		}
+	}
+
+	if err = parser.Write(&b, "xml", shell, data); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -1,15 +1,10 @@
 package parser
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
-	"os"
+	"io/ioutil"
 	"regexp"
-
-	"strconv"
 	"strings"
 
 	"github.com/dakyskye/dxhd/logger"
@@ -25,312 +20,138 @@ const (
 	EvtKeyRelease
 	EvtButtonPress
 	EvtButtonRelease
+	// EvtButtonDrag is fired whilst a button is held down and the pointer moves
+	EvtButtonDrag
+	// EvtHotCorner is fired when the pointer reaches a corner or an edge of the screen
+	EvtHotCorner
 )
 
+// HotCorners are the names of screen corners and edges hot corner bindings can use
+var HotCorners = []string{
+	"corner_top_left",
+	"corner_top_right",
+	"corner_bottom_left",
+	"corner_bottom_right",
+	"edge_top",
+	"edge_bottom",
+	"edge_left",
+	"edge_right",
+}
+
+// String returns the name of an event type
+func (e EventType) String() string {
+	switch e {
+	case EvtKeyPress:
+		return "key-press"
+	case EvtKeyRelease:
+		return "key-release"
+	case EvtButtonPress:
+		return "button-press"
+	case EvtButtonRelease:
+		return "button-release"
+	case EvtButtonDrag:
+		return "button-drag"
+	case EvtHotCorner:
+		return "hot-corner"
+	default:
+		return "unknown"
+	}
+}
+
 // FileData holds the data of parsed file
 type FileData struct {
 	OriginalBinding string
 	Binding         strings.Builder
 	Command         strings.Builder
 	EvtType         EventType
-	hasVariant      bool
-}
-
-// ranges hold the data of a keybinding and its command
-type ranges struct {
-	binding rng
-	command struct {
-		rng
-		skip      bool
-		numerical bool
-	}
-}
-
-type rng struct {
-	start, end       int
-	startStr, endStr string
-}
-
-type variantGroup struct {
-	binding, command []string
+	Device          string
+	// Description is the ## comment right above the binding
+	Description string
+	// Line is the line of the config the binding is on
+	Line int
 }
 
 // global regular expressions, compiled once at run-time
 var (
 	keybindingPattern   = regexp.MustCompile(`^#(((!?@?)|@?!?)\w+{.*?}|((!?@?)|@?!?){.*?}|((!?@?)|@?!?)\w+)(((\+(((!?@?)|@?!?)\w+{.*?}|((!?@?)|@?!?){.*?}|((!?@?)|@?!?)\w+)))+)?`)
 	variantPattern      = regexp.MustCompile(`{.*?}`)
-	bindingRangePattern = regexp.MustCompile(`([0-9]|[a-z])-([0-9]|[a-z])`)
-	commandRangePattern = regexp.MustCompile(`(?m)^(([0-9]+)-([0-9]+))|(([a-z])-([a-z]))$`)
-	numericalPattern    = regexp.MustCompile(`([0-9]+)-([0-9]+)`)
-	alphabeticalPattern = regexp.MustCompile(`([a-z])-([a-z])`)
+	bindingRangePattern = regexp.MustCompile(`^([0-9a-z])-([0-9a-z])$`)
+	commandRangePattern = regexp.MustCompile(`^(?:([0-9]+)-([0-9]+)|([a-z])-([a-z]))$`)
 	mouseBindPattern    = regexp.MustCompile(`mouse([0-9]+)`)
-	xfKeyPattern        = regexp.MustCompile(`XF86\w+`)
+	mouseDragPattern    = regexp.MustCompile(`mouse([0-9]+)drag`)
+	wheelPattern        = regexp.MustCompile(`wheel(up|down|left|right)`)
+	devicePattern       = regexp.MustCompile(`^#\s*\[device="([^"]*)"\]\s*`)
 )
 
+// wheels are shorthands for buttons 4-7
+var wheels = map[string]string{
+	"wheelup":    "mouse4",
+	"wheeldown":  "mouse5",
+	"wheelleft":  "mouse6",
+	"wheelright": "mouse7",
+}
+
 // Parse function parses given data
 func Parse(what interface{}, data *[]FileData) (shell, globals string, err error) {
 	if data == nil {
 		return "", "", errors.New("empty value was passed to parse function")
 	}
 
-	var reader *bufio.Reader
-
+	var src []byte
 	switch w := what.(type) {
 	case string:
-		configFile, e := os.Open(w)
-
-		if e != nil {
-			err = e
+		src, err = ioutil.ReadFile(w)
+		if err != nil {
 			return
 		}
-
-		defer func() {
-			e := configFile.Close()
-			if e != nil {
-				if err == nil {
-					err = e
-				} else {
-					logger.L().WithError(err).Debug("failed to close config file")
-				}
-			}
-		}()
-
-		reader = bufio.NewReader(configFile)
 	case []byte:
-		reader = bufio.NewReader(bytes.NewReader(w))
+		src = w
 	default:
 		err = errors.New("invalid type was passed to Parse function")
+		return
 	}
 
-	lineNumber := 0
-	shell = "/usr/bin/bash"
-	wasKeybinding := false
-	wasPrefix := false
-	datum := []FileData{}
-	index := 0
-	globalsBuilder := new(strings.Builder)
-	globalsEnded := false
-
-	// read file line by line
-	for {
-		lineNumber++
-
-		var (
-			line     []byte
-			isPrefix bool
-		)
-
-		line, isPrefix, err = reader.ReadLine()
-
-		if err != nil {
-			break
-		}
-
-		if index+1 != len(datum) {
-			datum = append(datum, FileData{})
-		}
-
-		lineStr := string(line)
-
-		// skip the shebang
-		if lineNumber == 1 && strings.HasPrefix(lineStr, "#!") {
-			shell = lineStr[2:]
-			continue
-		}
-
-		// skip an empty line
-		if lineStr == "" {
-			continue
-		}
-
-		if !strings.HasPrefix(lineStr, "#") && !globalsEnded {
-			globalsBuilder.WriteString(lineStr + "\n")
-			continue
-		}
-
-		// ignore comments (##+)
-		if strings.HasPrefix(lineStr, "##") {
-			if !globalsEnded {
-				globalsEnded = true
-			}
-			continue
-		}
-
-		// decide whether the line is a keybinding or not
-		if strings.HasPrefix(lineStr, "#") {
-			if isPrefix {
-				err = fmt.Errorf("a keybinding can't be that long, line %d, file %s", lineNumber, what)
-				return
-			}
-			if !globalsEnded {
-				globalsEnded = true
-			}
-			// erase spaces for key validation
-			lineStr = strings.ReplaceAll(lineStr, " ", "")
-
-			if keybindingPattern.MatchString(lineStr) {
-				if datum[index].Command.Len() != 0 {
-					index++
-					datum = append(datum, FileData{})
-				}
-				// trim # prefix
-				lineStr := lineStr[1:]
-
-				// overwrite previous prefix if needed
-				if wasKeybinding {
-					if datum[index].Binding.Len() != 0 {
-						datum[index].Binding.Reset()
-						logger.L().WithFields(logrus.Fields{"file": what, "line": lineNumber}).Info("overwriting keybinding")
-						logger.L().WithFields(logrus.Fields{"old": datum[index].Binding.String(), "new": lineStr}).Debug("overwriting keybinding")
-					}
-				}
-
-				// getEventType merges two events into one type
-				getEventType := func(old, new EventType) (evt EventType) {
-					switch old {
-					case EvtKeyPress:
-						evt = new
-					case EvtKeyRelease:
-						if new != EvtKeyPress {
-							evt = new
-						}
-					case EvtButtonPress:
-						if new == EvtKeyRelease || new == EvtButtonRelease {
-							evt = EvtButtonRelease
-						}
-					case EvtButtonRelease:
-						evt = EvtButtonRelease
-					default:
-						evt = new
-					}
-					return
-				}
-
-				// set to -1, in case a keybinding is a single letter
-				datum[index].EvtType = -1
-				for _, key := range strings.Split(lineStr, "+") {
-					if len(key) > 1 {
-						if strings.HasPrefix(key, "@mouse") {
-							datum[index].EvtType = getEventType(datum[index].EvtType, EvtButtonRelease)
-						} else if strings.HasPrefix(key, "mouse") {
-							datum[index].EvtType = getEventType(datum[index].EvtType, EvtButtonPress)
-						} else if strings.HasPrefix(key, "@") {
-							datum[index].EvtType = getEventType(datum[index].EvtType, EvtKeyRelease)
-						} else {
-							datum[index].EvtType = getEventType(datum[index].EvtType, EvtKeyPress)
-						}
+	tree := ParseTree(src)
 
-					}
-				}
-				// means a keybinding was the single letter
-				if datum[index].EvtType == -1 {
-					datum[index].EvtType = EvtKeyPress
-				}
-				_, err = datum[index].Binding.WriteString(lineStr)
-				if err != nil {
-					return
-				}
-				datum[index].hasVariant = len(variantPattern.FindStringIndex(lineStr)) > 0
-				wasKeybinding = true
-			}
-		} else {
-			wasKeybinding = false
-			if isPrefix {
-				if wasPrefix {
-					datum[index].Command.Write(line)
-				} else {
-					if datum[index].Command.Len() != 0 {
-						datum[index].Command.Write([]byte("\n"))
-					}
-					datum[index].Command.Write(line)
-					wasPrefix = true
-				}
-				continue
-			}
-
-			if wasPrefix {
-				datum[index].Command.Write(line)
-				wasPrefix = false
-			} else {
-				if datum[index].Command.Len() != 0 {
-					datum[index].Command.Write([]byte("\n"))
-				}
-				datum[index].Command.Write(line)
-			}
-		}
+	shell = "/usr/bin/bash"
+	if tree.Shebang != nil {
+		shell = tree.Shebang.Text[2:]
 	}
 
-	// we are ok when we reach the end of line
-	if err == io.EOF {
-		err = nil
-	} else {
-		return
+	globalsBuilder := new(strings.Builder)
+	for _, g := range tree.Globals {
+		globalsBuilder.WriteString(g.Text + "\n")
 	}
 
-	// xgb requires these shorthands to be replaced to what they are called internally
-	replaceShorthands := func(data *FileData) (err error) {
-		data.OriginalBinding = data.Binding.String()
-		data.Binding.Reset()
-
-		modified := data.OriginalBinding
-
-		// extract xf86 keys if any
-		matches := xfKeyPattern.FindAllString(modified, -1)
-		indexes := xfKeyPattern.FindAllStringIndex(modified, -1)
-		if len(matches) != len(indexes) {
-			err = errors.New("can not process XF86 keys properly")
-			return
-		}
-
-		// lowercase whole line
-		modified = strings.ToLower(modified)
-
-		// put XF86 keys as they were before in lineStr
-		for in, index := range indexes {
-			modified = strings.Replace(modified, modified[index[0]:index[1]], matches[in], 1)
+	*data = nil
+	// the description of an overwritten binding, given to the one overwriting it
+	description := ""
+	for i, block := range tree.Blocks {
+		if d := block.Description(); d != "" {
+			description = d
 		}
 
-		modified = strings.ReplaceAll(data.OriginalBinding, "+", "-")
-		modified = strings.ReplaceAll(modified, "super", "mod4")
-		modified = strings.ReplaceAll(modified, "alt", "mod1")
-		modified = strings.ReplaceAll(modified, "ctrl", "control")
-		modified = strings.ReplaceAll(strings.ReplaceAll(modified, "@", ""), "!", "")
-		// replace mouseN with N
-		if data.EvtType == EvtButtonPress || data.EvtType == EvtButtonRelease {
-			modified = mouseBindPattern.ReplaceAllString(modified, "$1")
+		// a binding without a command is overwritten by the next one
+		if len(block.Body.Lines) == 0 && i+1 < len(tree.Blocks) {
+			next := tree.Blocks[i+1].Binding
+			logger.L().WithFields(logrus.Fields{"file": what, "line": next.Line}).Info("overwriting keybinding")
+			logger.L().WithFields(logrus.Fields{"old": block.Binding.Text, "new": next.Text}).Debug("overwriting keybinding")
+			continue
 		}
-		_, err = data.Binding.WriteString(modified)
-		return
-	}
 
-	*data = nil
-	for _, d := range datum {
-		// replicate a keybinding and it's command if it has variants
-		if d.hasVariant {
-			replicated, e := replicate(d.Binding.String(), d.Command.String())
-			if e != nil {
-				err = fmt.Errorf("can't register %s keybinding, error (%s)", strings.TrimPrefix(d.Binding.String(), "#"), e.Error())
-				return
-			}
-			for _, repl := range replicated {
-				repl.EvtType = d.EvtType
-				err = replaceShorthands(repl)
-				if err != nil {
-					return
-				}
-				*data = append(*data, FileData{OriginalBinding: repl.OriginalBinding, Binding: repl.Binding, Command: repl.Command, EvtType: d.EvtType})
-			}
-		} else {
-			err = replaceShorthands(&d)
-			if err != nil {
-				return
-			}
-			*data = append(*data, FileData{OriginalBinding: d.OriginalBinding, Binding: d.Binding, Command: d.Command, EvtType: d.EvtType})
+		var bound []FileData
+		bound, err = expandBlock(block, description)
+		if err != nil {
+			binding := bindingVariants(block.Binding.Binding)
+			err = fmt.Errorf("can't register %s keybinding on line %d, error (%s)", binding.String(), block.Binding.Line, err.Error())
+			return
 		}
+		*data = append(*data, bound...)
+		description = ""
 	}
 
 	// means config file was empty
-	if len(*data) == 1 && ((*data)[0].Command.String() == "" || (*data)[0].Binding.String() == "") {
+	if len(*data) == 0 || len(*data) == 1 && (*data)[0].Command.Len() == 0 {
 		err = errors.New("config file does not contain any binding")
 		return
 	}
@@ -341,341 +162,145 @@ func Parse(what interface{}, data *[]FileData) (shell, globals string, err error
 	return
 }
 
-// replicate replicates variants
-func replicate(binding, command string) (replicated []*FileData, err error) {
-	// find all the variants
-	bindingVariants, commandVariants := variantPattern.FindAllString(binding, -1), variantPattern.FindAllString(command, -1)
-	// check if we need to populate command with variants
-	populateAmount := len(bindingVariants) - len(commandVariants)
-	if populateAmount < 0 {
-		err = errors.New("a command has more variants than its binding")
-		return
-	} else if populateAmount != 0 {
-		logger.L().WithField("binding", binding).Debug("adding blank variants to command is required")
-	}
-
-	var bindingVars, commandVars [][]string
-
-	// extract variant members
-	extract := func(from []string, where *[][]string) {
-		for _, f := range from {
-			*where = append(*where, strings.Split(strings.TrimSuffix(strings.TrimPrefix(f, "{"), "}"), ","))
+// Description returns the ## comments right above the binding of a block, joined by spaces
+func (b *Block) Description() (description string) {
+	for _, c := range b.Comments {
+		if !strings.HasPrefix(c.Text, "##") {
+			continue
 		}
+		comment := strings.TrimSpace(strings.TrimLeft(c.Text, "#"))
+		if description != "" && comment != "" {
+			description += " "
+		}
+		description += comment
 	}
+	return
+}
 
-	extract(bindingVariants, &bindingVars)
-	extract(commandVariants, &commandVars)
+// Expand replicates the binding of a block for each of its variants, exactly as Parse would do it
+func (b *Block) Expand() (data []FileData, err error) {
+	return expandBlock(b, b.Description())
+}
 
-	// validate the amount of variant memebers do match
-	if populateAmount == 0 {
-		for i, b := range bindingVars {
-			if len(b) != len(commandVars[i]) {
-				err = errors.New("the amounts of variant members in a keybinding and its command do not match")
-				return
-			}
-		}
-	} else {
-		for i, b := range bindingVars[populateAmount:] {
-			commandVars = append(commandVars, []string{})
-			variant := "{"
-			for range b {
-				commandVars[i] = append(commandVars[i], "_")
-				variant += "_,"
-			}
-			variant = strings.TrimSuffix(variant, ",")
-			variant += "}"
-			command += variant
-		}
-	}
+// expandBlock replicates the binding of a block for each of its variants, described by description
+func expandBlock(block *Block, description string) (data []FileData, err error) {
+	binding := bindingVariants(block.Binding.Binding)
+	original := binding.String()
 
-	// validate and extract ranges
-	var rngs []ranges
-	rngs, err = extractRanges(bindingVars, commandVars)
+	var desc variants
+	desc.add(description, 0, parseGroups(description, 0, commandRangePattern))
+
+	expanded, err := expand(binding, bodyVariants(block.Body), desc)
 	if err != nil {
 		return
 	}
 
-	var expandedBindingRanges, expandedCommandRanges []string
+	evtType := eventType(wheelPattern.ReplaceAllStringFunc(original, func(wheel string) string { return wheels[wheel] }))
+	device := ""
+	if matches := devicePattern.FindStringSubmatch(block.Binding.Text); matches != nil {
+		device = matches[1]
+	}
 
-	// expands a range in a keybinding({1-9} -> {1},{2},{3},{...},{9})
-	expandRange := func(r ranges, binding, acton string, bindings, commands *[]string) {
-		// bindings
-		for bIn := r.binding.start; bIn != r.binding.end+1; bIn++ {
-			*bindings = append(*bindings, strings.Replace(
-				binding,
-				fmt.Sprintf("%s-%s", r.binding.startStr, r.binding.endStr),
-				fmt.Sprintf("%c", rune(bIn)),
-				1,
-			))
-			if r.command.skip {
-				*commands = append(*commands, acton)
-			}
-		}
-		// commands
-		if !r.command.skip {
-			for aIn := r.command.start; aIn != r.command.end+1; aIn++ {
-				if r.command.numerical {
-					*commands = append(*commands, strings.Replace(
-						command,
-						fmt.Sprintf("%s-%s", r.command.startStr, r.command.endStr),
-						fmt.Sprintf("%d", aIn),
-						1,
-					))
-				} else {
-					*commands = append(*commands, strings.Replace(
-						command,
-						fmt.Sprintf("%s-%s", r.command.startStr, r.command.endStr),
-						fmt.Sprintf("%c", rune(aIn)),
-						1,
-					))
-				}
-			}
+	for _, e := range expanded {
+		d := FileData{
+			OriginalBinding: wheelPattern.ReplaceAllStringFunc(e.binding, func(wheel string) string { return wheels[wheel] }),
+			EvtType:         evtType,
+			Device:          device,
+			Line:            block.Binding.Line,
+			Description:     e.description,
 		}
+		d.Binding.WriteString(translate(d.OriginalBinding, evtType))
+		d.Command.WriteString(e.command)
+		data = append(data, d)
 	}
+	return
+}
 
-	// for as long as we have unexpanded ranges, expand them
-	for len(rngs) > 0 {
-		if len(expandedBindingRanges) > 0 {
-			var newBindingRanges, newCommandRanges []string
-
-			if len(expandedCommandRanges) != len(expandedBindingRanges) {
-				err = errors.New("an unknown error occurred whilst expanding keybinding and command ranges")
+// eventType tells the event a binding is fired on
+func eventType(binding string) (evt EventType) {
+	// getEventType merges two events into one type
+	getEventType := func(old, new EventType) (evt EventType) {
+		switch old {
+		case EvtKeyPress:
+			evt = new
+		case EvtKeyRelease:
+			evt = old
+			if new != EvtKeyPress {
+				evt = new
 			}
-
-			for i := 0; i != len(expandedBindingRanges); i++ {
-				expandRange(rngs[0], expandedBindingRanges[i], expandedCommandRanges[i], &newBindingRanges, &newCommandRanges)
+		case EvtButtonPress:
+			evt = old
+			if new == EvtKeyRelease || new == EvtButtonRelease {
+				evt = EvtButtonRelease
 			}
-
-			expandedBindingRanges, expandedCommandRanges = newBindingRanges, newCommandRanges
-		} else {
-			expandRange(rngs[0], binding, command, &expandedBindingRanges, &expandedCommandRanges)
+		case EvtButtonRelease:
+			evt = EvtButtonRelease
+		default:
+			evt = new
 		}
-		rngs = rngs[1:]
-	}
-
-	if len(expandedCommandRanges) != len(expandedBindingRanges) {
-		err = errors.New("an unknown error occurred whilst expanding keybinding and command ranges")
+		return
 	}
 
-	// replicateVariant replaces pattern with each member of variants group
-	replicateVariant := func(in, pattern string, variants []string, where *[]string) {
-		for _, v := range variants {
-			if v == "_" {
-				*where = append(*where, strings.Replace(
-					in,
-					pattern,
-					"",
-					1,
-				))
+	// set to -1, in case a keybinding is a single letter
+	evt = -1
+	for _, key := range strings.Split(binding, "+") {
+		if len(key) > 1 {
+			if strings.HasPrefix(key, "@mouse") {
+				evt = getEventType(evt, EvtButtonRelease)
+			} else if strings.HasPrefix(key, "mouse") {
+				evt = getEventType(evt, EvtButtonPress)
+			} else if strings.HasPrefix(key, "@") {
+				evt = getEventType(evt, EvtKeyRelease)
 			} else {
-				*where = append(*where, strings.Replace(
-					in,
-					pattern,
-					v,
-					1,
-				))
+				evt = getEventType(evt, EvtKeyPress)
 			}
 		}
 	}
-
-	// in case our keybinding and command had no ranges
-	if len(expandedBindingRanges) == 0 {
-		expandedBindingRanges = append(expandedBindingRanges, binding)
-		expandedCommandRanges = append(expandedCommandRanges, command)
+	// means a keybinding was the single letter
+	if evt == -1 {
+		evt = EvtKeyPress
 	}
-
-	// do replicate every variant member
-	for i, r := 0, 0; i != len(expandedBindingRanges); i++ {
-		var replicatedBindings, replicatedCommands []string
-		vGroup := &variantGroup{}
-		vGroup.command = variantPattern.FindAllString(expandedCommandRanges[i], -1)
-		vGroup.binding = variantPattern.FindAllString(expandedBindingRanges[i], -1)
-
-		if !(len(vGroup.command) == len(vGroup.binding) && len(vGroup.command) > 0) {
-			err = errors.New("can not extract variant groups")
-			return
-		}
-
-		// for as long as we have binding AND command in a variant group
-		for len(vGroup.binding) > 0 {
-			// extract variant members
-			bVariantMembers := strings.Split(strings.TrimSuffix(strings.TrimPrefix(vGroup.binding[0], "{"), "}"), ",")
-			aVariantMembers := strings.Split(strings.TrimSuffix(strings.TrimPrefix(vGroup.command[0], "{"), "}"), ",")
-			// if we already replicated a variant, use it
-			if len(replicatedBindings) > 0 {
-				var newBindingVariants, newCommandVariants []string
-
-				for _, alreadyR := range replicatedBindings {
-					replicateVariant(alreadyR, vGroup.binding[0], bVariantMembers, &newBindingVariants)
-				}
-
-				for _, alreadyR := range replicatedCommands {
-					replicateVariant(alreadyR, vGroup.command[0], aVariantMembers, &newCommandVariants)
-				}
-
-				replicatedBindings, replicatedCommands = newBindingVariants, newCommandVariants
-			} else {
-				replicateVariant(expandedBindingRanges[i], vGroup.binding[0], bVariantMembers, &replicatedBindings)
-				replicateVariant(expandedCommandRanges[i], vGroup.command[0], aVariantMembers, &replicatedCommands)
-			}
-			vGroup.binding = vGroup.binding[1:]
-			vGroup.command = vGroup.command[1:]
-		}
-
-		if len(replicatedBindings) != len(replicatedCommands) {
-			err = errors.New("replication went wrong")
-			return
-		}
-
-		// append replicated bindings and command to the return result
-	appender:
-		for i := 0; i != len(replicatedBindings); i++ {
-			// we get ++ when we replace underscore literal with nothing
-			replicatedBindings[i] = strings.ReplaceAll(replicatedBindings[i], "++", "+")
-			if i > 0 {
-				for _, aR := range replicated {
-
-					if aR.Binding.String() == replicatedBindings[i] {
-						continue appender
-					}
-				}
-			}
-			replicated = append(replicated, &FileData{})
-			_, err = replicated[r].Binding.WriteString(replicatedBindings[i])
-			if err != nil {
-				return
-			}
-			_, err = replicated[r].Command.WriteString(replicatedCommands[i])
-			if err != nil {
-				return
-			}
-			r++
+	// drags and hot corners take precedence over any other event
+	if mouseDragPattern.MatchString(binding) {
+		evt = EvtButtonDrag
+	}
+	for _, corner := range HotCorners {
+		if strings.Contains(binding, corner) {
+			evt = EvtHotCorner
 		}
 	}
-
 	return
 }
 
-// extracts every range from a config file
-func extractRanges(bindingVars, commandVars [][]string) (r []ranges, err error) {
-	// range patterns for binding and command and range errors
-	var (
-		rangeParseErr   = errors.New("could not parse a range")
-		invalidRangeErr = errors.New("invalid parse given")
-	)
-	// iterate over a binding variants, and replicate ranges
-	for bIn, bVars := range bindingVars {
-		// iterate over the variants of the binding variants
-		for vIn, bVar := range bVars {
-			// check if the variant is a range
-			if bindingRangePattern.MatchString(bVar) {
-				bRange := bindingRangePattern.FindStringSubmatch(bVar)
-				if len(bRange) != 3 {
-					err = rangeParseErr
-					return
-				}
-				var (
-					aVar             = commandVars[bIn][vIn]
-					aRange           []string
-					aRangeValidation = true
-				)
-				// make sure command variant is also a range (or _)
-				if !commandRangePattern.MatchString(aVar) {
-					if aVar == "_" {
-						// in case it's _, skip the range validation
-						aRangeValidation = false
-					} else {
-						err = errors.New("the indexes of ranges for a keybinding and its command do not match")
-						return
-					}
-				}
-
-				// int values for comparison
-				// string values for assignment
-				var (
-					bStart, bEnd       int
-					bStartStr, bEndStr string
-				)
-
-				// convert strings to runes to int
-				bStart = int([]rune(bRange[1])[0])
-				bEnd = int([]rune(bRange[2])[0])
-
-				// make sure the given range is valid
-				if bStart >= bEnd {
-					err = invalidRangeErr
-					return
-				}
-
-				// assign string values
-				bStartStr = string(rune(bStart))
-				bEndStr = string(rune(bEnd))
-
-				var (
-					aStart, aEnd       int
-					aStartStr, aEndStr string
-					aNumerical         = false
-				)
-
-				if aRangeValidation {
-					if numericalPattern.MatchString(aVar) { // is it a numerical range?
-						aRange = numericalPattern.FindStringSubmatch(aVar)
-						if len(aRange) != 3 {
-							err = rangeParseErr
-							return
-						}
-						aStart, err = strconv.Atoi(aRange[1])
-						if err != nil {
-							return
-						}
-						aEnd, err = strconv.Atoi(aRange[2])
-						if err != nil {
-							return
-						}
-						for _, a := range aRange[1] {
-							aStartStr += string(a)
-						}
-						for _, a := range aRange[2] {
-							aEndStr += string(a)
-						}
-						aNumerical = true
-					} else if alphabeticalPattern.MatchString(aVar) { // well, is it an alphabetical range?
-						aRange = alphabeticalPattern.FindStringSubmatch(aVar)
-						if len(aRange) != 3 {
-							err = rangeParseErr
-							return
-						}
-						aStart = int([]rune(aRange[1])[0])
-						aEnd = int([]rune(aRange[2])[0])
-						aStartStr = string(rune(aStart))
-						aEndStr = string(rune(aEnd))
-					} else { // it's an invalid range
-						err = invalidRangeErr
-						return
-					}
-					// make sure the ranges match
-					// 1-9 compared to 11-19 is a valid range
-					// 4-8 compared to a-e is a valid range also
-					// b start-end        a start-end
-					if (bStart - bEnd) != (aStart - aEnd) {
-						err = errors.New("the ranges of a keybinding and its command do not match")
-						return
-					}
-				}
-				r = append(r, ranges{})
-				r[len(r)-1].binding.start = bStart
-				r[len(r)-1].binding.startStr = bStartStr
-				r[len(r)-1].binding.end = bEnd
-				r[len(r)-1].binding.endStr = bEndStr
+// translate replaces the shorthands of a binding with what xgb calls them internally
+func translate(binding string, evt EventType) (translated string) {
+	translated = strings.ReplaceAll(binding, "+", "-")
+	translated = strings.ReplaceAll(translated, "super", "mod4")
+	translated = strings.ReplaceAll(translated, "alt", "mod1")
+	translated = strings.ReplaceAll(translated, "ctrl", "control")
+	translated = strings.ReplaceAll(strings.ReplaceAll(translated, "@", ""), "!", "")
+	// replace mouseN (and mouseNdrag) with N
+	if evt == EvtButtonDrag {
+		translated = mouseDragPattern.ReplaceAllString(translated, "$1")
+	}
+	if evt == EvtButtonPress || evt == EvtButtonRelease {
+		translated = mouseBindPattern.ReplaceAllString(translated, "$1")
+	}
+	return
+}
 
-				r[len(r)-1].command.start = aStart
-				r[len(r)-1].command.startStr = aStartStr
-				r[len(r)-1].command.end = aEnd
-				r[len(r)-1].command.endStr = aEndStr
-				r[len(r)-1].command.skip = !aRangeValidation
-				r[len(r)-1].command.numerical = aNumerical
-			}
-		}
+// Translate translates a single keybinding written in config syntax (e.g. super + shift + a)
+// to the format xgb expects, exactly as Parse would do it
+func Translate(binding string) (translated string, err error) {
+	var data []FileData
+	_, _, err = Parse([]byte(fmt.Sprintf("#!/bin/sh\n# %s\n:\n", binding)), &data)
+	if err != nil {
+		return
+	}
+	if len(data) != 1 {
+		err = fmt.Errorf("%s is not a single keybinding", binding)
+		return
 	}
+	translated = data[0].Binding.String()
 	return
 }
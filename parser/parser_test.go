@@ -0,0 +1,122 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+func TestDescriptions(t *testing.T) {
+	var data []parser.FileData
+	_, _, err := parser.Parse([]byte(`#!/bin/sh
+## restart i3
+## and reload its config
+# super + shift + r
+i3-msg restart
+
+## not above a binding
+
+# super + a
+echo a
+## a {brace} the binding has no variants for
+# super + {b,c}
+echo {b,c}
+`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"super+shift+r": "restart i3 and reload its config",
+		"super+a":       "",
+		"super+b":       "a {brace} the binding has no variants for",
+		"super+c":       "a {brace} the binding has no variants for",
+	}
+	if len(data) != len(want) {
+		t.Fatalf("expected %d bindings, got %d", len(want), len(data))
+	}
+	for _, d := range data {
+		if d.Description != want[d.OriginalBinding] {
+			t.Errorf("%s: expected description %q, got %q", d.OriginalBinding, want[d.OriginalBinding], d.Description)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		config string
+		want   []string
+		err    string
+	}{
+		{
+			config: "# super + {_,shift + }{1-3,0}\ni3-msg {workspace,move container to workspace} {1-3,10}\n",
+			want: []string{
+				"super+1: i3-msg workspace 1",
+				"super+2: i3-msg workspace 2",
+				"super+3: i3-msg workspace 3",
+				"super+0: i3-msg workspace 10",
+				"super+shift+1: i3-msg move container to workspace 1",
+				"super+shift+2: i3-msg move container to workspace 2",
+				"super+shift+3: i3-msg move container to workspace 3",
+				"super+shift+0: i3-msg move container to workspace 10",
+			},
+		},
+		{
+			config: "# alt + {a-c}\necho {x-z}\n# alt + {1-2}\necho {_}\n",
+			want:   []string{"alt+a: echo x", "alt+b: echo y", "alt+c: echo z", "alt+1: echo ", "alt+2: echo "},
+		},
+		{
+			// a binding group without a command group leaves the command as it is
+			config: "# super + {_,shift + }Return\necho a\necho b\n",
+			want:   []string{"super+Return: echo a\necho b", "super+shift+Return: echo a\necho b"},
+		},
+		{
+			// braces are no variants unless the binding has some
+			config: "# super + a\nawk '{print}' ${HOME}\n",
+			want:   []string{"super+a: awk '{print}' ${HOME}"},
+		},
+		{
+			config: "# super + a\n\n# super + b\necho b\n",
+			want:   []string{"super+b: echo b"},
+		},
+		{
+			config: "# super + {a,b}\necho {a,b,c}\n",
+			err:    "can't register super+{a,b} keybinding on line 2, error (the amounts of variant members in a keybinding and its command do not match)",
+		},
+		{
+			config: "# super + {1-3}\necho {1-9}\n",
+			err:    "can't register super+{1-3} keybinding on line 2, error (the ranges of a keybinding and its command do not match)",
+		},
+		{
+			config: "# super + a\necho a\n# super + {b}\necho {b} {c}\n",
+			err:    "can't register super+{b} keybinding on line 4, error (a command has more variants than its binding)",
+		},
+		{
+			config: "foo=1\n",
+			err:    "config file does not contain any binding",
+		},
+	}
+
+	for _, test := range tests {
+		var data []parser.FileData
+		_, _, err := parser.Parse([]byte("#!/bin/sh\n"+test.config), &data)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.config, err)
+			continue
+		}
+		var got []string
+		for _, d := range data {
+			got = append(got, d.OriginalBinding+": "+d.Command.String())
+		}
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%q: expected %q, got %q", test.config, test.want, got)
+		}
+	}
+}
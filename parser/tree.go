@@ -0,0 +1,258 @@
+package parser
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// NodeKind is the kind of a line of a config
+type NodeKind int8
+
+// node kinds
+const (
+	NodeShebang NodeKind = iota
+	NodeGlobal
+	NodeBlank
+	NodeComment
+	NodeBinding
+	NodeCommand
+)
+
+// Tree is the lossless syntax tree of a config, the text of its nodes joined by line breaks is the config
+type Tree struct {
+	Src   []byte
+	Nodes []Node
+	// Shebang is the shebang line, nil if the config has none
+	Shebang *Node
+	// Globals are the lines run before every command
+	Globals []*Node
+	// Blocks are the bindings of the config, in order
+	Blocks []*Block
+}
+
+// Block is a binding line with the comments right above it and its command
+type Block struct {
+	Comments []*Node
+	Binding  *Node
+	Body     Body
+}
+
+// Body is the command of a binding, the comment and blank lines within it excluded
+type Body struct {
+	Lines []*Node
+	// Groups are the variant groups of every line
+	Groups []Group
+}
+
+// Node is a line of a config
+type Node struct {
+	Kind NodeKind
+	// Line is the number of the line, Start and End are the byte offsets of its text, its line break excluded
+	Line       int
+	Start, End int
+	Text       string
+	// Binding is set for binding lines
+	Binding *BindingLine
+}
+
+// BindingLine is a binding line split into its parts
+type BindingLine struct {
+	// Device is the device qualifier, like [device="name"], if any
+	Device *Token
+	// Keys are the keys of the binding, its text split by the pluses outside of variant groups
+	Keys []Key
+}
+
+// Key is a key of a binding and the variant groups in it
+type Key struct {
+	Token
+	Groups []Group
+}
+
+// Group is a variant group, like {a,b} or {1-9,0}
+type Group struct {
+	Token
+	Members []Member
+}
+
+// Member is a member of a variant group, the text between the braces and commas as it is
+type Member struct {
+	Token
+	// Range is set if the member is a range, like 1-9 or a-z
+	Range *Range
+}
+
+// Range is the first and the last value of a range
+type Range struct {
+	From, To string
+}
+
+// Token is a part of a line, Start and End are its byte offsets in the config
+type Token struct {
+	Start, End int
+	Text       string
+}
+
+// ParseTree parses a config into its syntax tree, it never fails,
+// lines are told apart the same way Parse does
+func ParseTree(src []byte) *Tree {
+	t := &Tree{Src: src}
+
+	globalsEnded := false
+	start := 0
+	for number := 1; start <= len(src); number++ {
+		next := start + bytes.IndexByte(src[start:], '\n')
+		if next < start {
+			next = len(src)
+			// a config ending with a line break has no last line
+			if start == next && number > 1 {
+				break
+			}
+		}
+		// the line break of a config written on windows is not part of its lines
+		end := next
+		if end > start && src[end-1] == '\r' {
+			end--
+		}
+		text := string(src[start:end])
+		n := Node{Line: number, Start: start, End: end, Text: text}
+
+		switch {
+		case number == 1 && strings.HasPrefix(text, "#!"):
+			n.Kind = NodeShebang
+		case text == "":
+			n.Kind = NodeBlank
+		case !strings.HasPrefix(text, "#") && !globalsEnded:
+			n.Kind = NodeGlobal
+		case strings.HasPrefix(text, "##"):
+			n.Kind = NodeComment
+			globalsEnded = true
+		case strings.HasPrefix(text, "#"):
+			globalsEnded = true
+			n.Kind = NodeComment
+			if b := parseBindingLine(text, start); b != nil {
+				n.Kind, n.Binding = NodeBinding, b
+			}
+		default:
+			n.Kind = NodeCommand
+		}
+
+		t.Nodes = append(t.Nodes, n)
+		start = next + 1
+	}
+
+	// the comments right above the current line
+	var comments []*Node
+	var block *Block
+	for i := range t.Nodes {
+		n := &t.Nodes[i]
+		switch n.Kind {
+		case NodeShebang:
+			t.Shebang = n
+		case NodeGlobal:
+			t.Globals = append(t.Globals, n)
+		case NodeBlank:
+			comments = nil
+		case NodeComment:
+			comments = append(comments, n)
+		case NodeBinding:
+			block = &Block{Comments: comments, Binding: n}
+			t.Blocks = append(t.Blocks, block)
+			comments = nil
+		case NodeCommand:
+			comments = nil
+			// a command above every binding belongs to none
+			if block != nil {
+				block.Body.Lines = append(block.Body.Lines, n)
+				block.Body.Groups = append(block.Body.Groups, parseGroups(n.Text, n.Start, commandRangePattern)...)
+			}
+		}
+	}
+
+	return t
+}
+
+// parseGroups finds the variant groups of a text, a member matching pattern is a range
+func parseGroups(text string, offset int, pattern *regexp.Regexp) (groups []Group) {
+	for _, m := range variantPattern.FindAllStringIndex(text, -1) {
+		g := Group{Token: Token{Start: offset + m[0], End: offset + m[1], Text: text[m[0]:m[1]]}}
+		at := m[0] + 1
+		for _, member := range strings.Split(text[m[0]+1:m[1]-1], ",") {
+			mem := Member{Token: Token{Start: offset + at, End: offset + at + len(member), Text: member}}
+			if r := pattern.FindStringSubmatch(strings.ReplaceAll(member, " ", "")); r != nil {
+				// the first matched pair of values, patterns may have alternatives
+				for i := 1; i+1 < len(r); i += 2 {
+					if r[i] != "" {
+						mem.Range = &Range{From: r[i], To: r[i+1]}
+						break
+					}
+				}
+			}
+			g.Members = append(g.Members, mem)
+			at += len(member) + 1
+		}
+		groups = append(groups, g)
+	}
+	return
+}
+
+// parseBindingLine splits a line starting with # into a binding, nil if it's not one
+func parseBindingLine(text string, offset int) (b *BindingLine) {
+	rest := text
+	var device *Token
+	if m := devicePattern.FindStringSubmatchIndex(rest); m != nil {
+		// the qualifier without the # and the spaces around it
+		qualifier := strings.TrimSpace(rest[1:m[1]])
+		at := strings.Index(rest, qualifier)
+		device = &Token{Start: offset + at, End: offset + at + len(qualifier), Text: qualifier}
+		rest = "#" + rest[m[1]:]
+		offset += m[1] - 1
+	}
+
+	if !keybindingPattern.MatchString(strings.ReplaceAll(rest, " ", "")) {
+		return nil
+	}
+
+	b = &BindingLine{Device: device}
+	depth, from := 0, 1
+	split := func(to int) {
+		key := rest[from:to]
+		trimmed := strings.TrimSpace(key)
+		at := from + strings.Index(key, trimmed)
+		b.Keys = append(b.Keys, Key{
+			Token:  Token{Start: offset + at, End: offset + at + len(trimmed), Text: trimmed},
+			Groups: parseGroups(trimmed, offset+at, bindingRangePattern),
+		})
+		from = to + 1
+	}
+	for i := 1; i < len(rest); i++ {
+		switch rest[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '+':
+			if depth == 0 {
+				split(i)
+			}
+		}
+	}
+	split(len(rest))
+	return
+}
+
+// String returns the config of the tree, rebuilt from its nodes
+func (t *Tree) String() string {
+	var b strings.Builder
+	for i, n := range t.Nodes {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(n.Text)
+	}
+	if len(t.Src) > 0 && t.Src[len(t.Src)-1] == '\n' {
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
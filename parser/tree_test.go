@@ -0,0 +1,84 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/dakyskye/dxhd/parser"
+)
+
+func TestParseTreeBlocks(t *testing.T) {
+	const src = `#!/bin/sh
+foo=1
+## switch
+# super + {_,shift + }{1-9,0}
+i3-msg {workspace,move container to workspace} {1-9,10}
+
+echo done
+# alt + x
+`
+	tree := parser.ParseTree([]byte(src))
+	if tree.Shebang == nil || tree.Shebang.Text != "#!/bin/sh" {
+		t.Fatalf("unexpected shebang %+v", tree.Shebang)
+	}
+	if len(tree.Globals) != 1 || tree.Globals[0].Text != "foo=1" {
+		t.Fatalf("unexpected globals %+v", tree.Globals)
+	}
+	if len(tree.Blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(tree.Blocks))
+	}
+
+	block := tree.Blocks[0]
+	if block.Description() != "switch" || len(block.Body.Lines) != 2 || len(tree.Blocks[1].Body.Lines) != 0 {
+		t.Fatalf("unexpected block %+v", block)
+	}
+
+	at := func(token parser.Token) {
+		t.Helper()
+		if src[token.Start:token.End] != token.Text {
+			t.Errorf("%q is not at %d-%d", token.Text, token.Start, token.End)
+		}
+	}
+
+	var groups []parser.Group
+	for _, key := range block.Binding.Binding.Keys {
+		at(key.Token)
+		groups = append(groups, key.Groups...)
+	}
+	groups = append(groups, block.Body.Groups...)
+	want := []string{"{_,shift + }", "{1-9,0}", "{workspace,move container to workspace}", "{1-9,10}"}
+	if len(groups) != len(want) {
+		t.Fatalf("expected %d groups, got %d", len(want), len(groups))
+	}
+	for i, g := range groups {
+		at(g.Token)
+		if g.Text != want[i] {
+			t.Errorf("expected group %q, got %q", want[i], g.Text)
+		}
+		for _, m := range g.Members {
+			at(m.Token)
+		}
+	}
+
+	for _, g := range []parser.Group{groups[1], groups[3]} {
+		if r := g.Members[0].Range; r == nil || r.From != g.Members[0].Text[:1] {
+			t.Errorf("expected %q to be a range, got %+v", g.Members[0].Text, r)
+		}
+		if g.Members[1].Range != nil {
+			t.Errorf("expected %q not to be a range", g.Members[1].Text)
+		}
+	}
+}
+
+func TestParseTreeCRLF(t *testing.T) {
+	var data []parser.FileData
+	shell, _, err := parser.Parse([]byte("#!/bin/sh\r\n# super + a\r\necho a\r\n\r\n# super + b\r\necho b\r\n"), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shell != "/bin/sh" {
+		t.Errorf("expected the shell /bin/sh, got %q", shell)
+	}
+	if len(data) != 2 || data[0].Command.String() != "echo a" || data[1].Command.String() != "echo b" {
+		t.Errorf("expected the commands without carriage returns, got %+v", data)
+	}
+}
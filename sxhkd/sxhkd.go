@@ -0,0 +1,154 @@
+// Package sxhkd converts sxhkd configs to dxhd configs
+package sxhkd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Shell is the shell of converted configs
+const Shell = "/bin/sh"
+
+// Unsupported is a construct of an sxhkd config dxhd has no equivalent of
+type Unsupported struct {
+	Line   int
+	Reason string
+}
+
+func (u Unsupported) Error() string {
+	return fmt.Sprintf("line %d: %s", u.Line, u.Reason)
+}
+
+var (
+	buttonPattern  = regexp.MustCompile(`\bbutton([0-9]+)\b`)
+	controlPattern = regexp.MustCompile(`\bcontrol\b`)
+	// modifiers sxhkd resolves from the keyboard mapping, which X names don't exist for
+	mappedPattern = regexp.MustCompile(`\b(hyper|meta|mode_switch)\b`)
+)
+
+// line is a logical line of an sxhkd config, backslash continuations joined
+type line struct {
+	number int
+	text   string
+}
+
+// lines reads the logical lines of an sxhkd config
+func lines(r io.Reader) (logical []line, err error) {
+	scanner := bufio.NewScanner(r)
+	number := 0
+	var continued *line
+	for scanner.Scan() {
+		number++
+		text := scanner.Text()
+		if continued != nil {
+			continued.text += text
+		} else {
+			logical = append(logical, line{number: number, text: text})
+			continued = &logical[len(logical)-1]
+		}
+		if strings.HasSuffix(continued.text, `\`) {
+			continued.text = strings.TrimSuffix(continued.text, `\`)
+		} else {
+			continued = nil
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// binding converts a hotkey of sxhkd to a dxhd binding
+func binding(hotkey string, number int) (converted string, unsupported []Unsupported) {
+	if strings.ContainsAny(hotkey, ";:") {
+		return "", []Unsupported{{number, "chords are not supported, " + strings.TrimSpace(hotkey) + " is left commented out"}}
+	}
+	// dxhd would swallow the event the program under the pointer expects to get
+	if strings.Contains(hotkey, "~") {
+		return "", []Unsupported{{number, "replaying events (~) is not supported, " + strings.TrimSpace(hotkey) + " is left commented out"}}
+	}
+	if m := mappedPattern.FindString(hotkey); m != "" {
+		unsupported = append(unsupported, Unsupported{number, m + " is not supported, use the modifier it is mapped to, like mod3"})
+	}
+	hotkey = buttonPattern.ReplaceAllString(hotkey, "mouse$1")
+	hotkey = controlPattern.ReplaceAllString(hotkey, "ctrl")
+	return strings.Join(strings.Fields(hotkey), " "), unsupported
+}
+
+// Convert converts an sxhkd config to a dxhd config, reporting what could not be converted
+func Convert(r io.Reader) (config string, unsupported []Unsupported, err error) {
+	logical, err := lines(r)
+	if err != nil {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("#!" + Shell + "\n")
+
+	// blank tells whether the last written line was empty, commented whether it was of a commented out binding
+	blank, commented := false, false
+	write := func(text string, ofCommented bool) {
+		b.WriteString(text + "\n")
+		blank, commented = text == "", ofCommented
+	}
+	// separate keeps a commented out binding from becoming the description of the next one
+	separate := func() {
+		if commented && !blank {
+			write("", false)
+		}
+	}
+
+	// hotkey waits for its command, it's only written once it has one
+	var hotkey *line
+	converted, inBody := "", false
+	flush := func() {
+		if hotkey != nil {
+			unsupported = append(unsupported, Unsupported{hotkey.number, "a hotkey without a command is ignored"})
+			write("## "+strings.TrimSpace(hotkey.text), true)
+		}
+		hotkey, inBody = nil, false
+	}
+
+	for i, l := range logical {
+		text := strings.TrimRight(l.text, " \t")
+		switch {
+		case text == "":
+			flush()
+			write("", false)
+		case strings.HasPrefix(text, "#"):
+			flush()
+			separate()
+			write(strings.TrimSpace("## "+strings.TrimSpace(strings.TrimLeft(text, "#"))), false)
+		case text[0] == ' ' || text[0] == '\t':
+			if hotkey == nil && !inBody {
+				unsupported = append(unsupported, Unsupported{l.number, "a command without a hotkey is ignored"})
+				continue
+			}
+			if hotkey != nil {
+				if converted == "" {
+					write("## "+strings.TrimSpace(hotkey.text), true)
+				} else {
+					write("# "+converted, false)
+				}
+				hotkey, inBody = nil, true
+			}
+			if command := strings.TrimSpace(text); converted == "" {
+				write("## "+command, true)
+			} else {
+				write(command, false)
+			}
+		default:
+			flush()
+			separate()
+			var u []Unsupported
+			converted, u = binding(text, l.number)
+			unsupported = append(unsupported, u...)
+			hotkey = &logical[i]
+		}
+	}
+	flush()
+
+	config = b.String()
+	return
+}
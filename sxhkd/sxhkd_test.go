@@ -0,0 +1,93 @@
+package sxhkd_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dakyskye/dxhd/parser"
+	"github.com/dakyskye/dxhd/sxhkd"
+)
+
+func TestConvert(t *testing.T) {
+	config, unsupported, err := sxhkd.Convert(strings.NewReader(`#
+# bspwm hotkeys
+
+# focus or send to the given desktop
+super + {_,shift + }{1-9,0}
+	bspc {desktop -f,node -d} '^{1-9,10}'
+
+super + control + @{h,l}
+	bspc node -z {left -20 0,right 20 0}
+# chord
+super + w ; {a,b}
+	echo {a,b}
+# continued
+super + \
+  shift + x
+	notify-send \
+hello
+~button1
+	echo click
+	echo twice
+super + y
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `#!/bin/sh
+##
+## bspwm hotkeys
+
+## focus or send to the given desktop
+# super + {_,shift + }{1-9,0}
+bspc {desktop -f,node -d} '^{1-9,10}'
+
+# super + ctrl + @{h,l}
+bspc node -z {left -20 0,right 20 0}
+## chord
+## super + w ; {a,b}
+## echo {a,b}
+
+## continued
+# super + shift + x
+notify-send hello
+## ~button1
+## echo click
+## echo twice
+
+## super + y
+`
+	if config != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, config)
+	}
+
+	// the desktops, the resizes and the continued one
+	var data []parser.FileData
+	if _, _, err = parser.Parse([]byte(config), &data); err != nil || len(data) != 20+2+1 {
+		t.Errorf("expected the converted config to have 23 bindings, got %d, %v", len(data), err)
+	}
+
+	var lines []int
+	for _, u := range unsupported {
+		lines = append(lines, u.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{11, 18, 21}) {
+		t.Errorf("expected unsupported constructs on lines 11, 18 and 21, got %v", unsupported)
+	}
+}
+
+func TestConvertReplayed(t *testing.T) {
+	config, unsupported, err := sxhkd.Convert(strings.NewReader("~button1\n\techo click\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "#!/bin/sh\n## ~button1\n## echo click\n"; config != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, config)
+	}
+	if len(unsupported) != 1 || unsupported[0].Line != 1 || !strings.Contains(unsupported[0].Reason, "~button1 is left commented out") {
+		t.Errorf("expected ~button1 to be reported as left commented out, got %v", unsupported)
+	}
+}
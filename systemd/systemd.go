@@ -0,0 +1,72 @@
+// Package systemd tells systemd about dxhd's state and runs commands in their own scope units
+package systemd
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// states sent to systemd
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+	Watchdog  = "WATCHDOG=1"
+)
+
+// Notify sends a state to systemd over $NOTIFY_SOCKET, it returns false if dxhd was not started by a Type=notify unit
+func Notify(state string) (sent bool, err error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if socket[0] == '@' {
+		// an abstract socket
+		addr.Name = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return
+	}
+	sent = true
+	return
+}
+
+// WatchdogInterval returns how often systemd expects a watchdog ping, 0 if the unit has no watchdog
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		// the watchdog is meant for another process
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// ScopeCommand returns a command running name with args in a transient scope unit of the user's service manager,
+// so it's not part of dxhd's own unit and outlives its restarts
+func ScopeCommand(description, name string, args ...string) *exec.Cmd {
+	return exec.Command("systemd-run", append([]string{
+		"--user",
+		"--scope",
+		"--quiet",
+		"--collect",
+		"--description=" + description,
+		"--",
+		name,
+	}, args...)...)
+}
@@ -0,0 +1,61 @@
+package systemd_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dakyskye/dxhd/systemd"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	sent, err := systemd.Notify(systemd.Ready)
+	if err != nil || !sent {
+		t.Fatalf("expected the state to be sent, got %v, %v", sent, err)
+	}
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != systemd.Ready {
+		t.Fatalf("expected %q, got %q", systemd.Ready, got)
+	}
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+
+	if sent, err := systemd.Notify(systemd.Ready); sent || err != nil {
+		t.Fatalf("expected nothing to be sent, got %v, %v", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer os.Unsetenv("WATCHDOG_USEC")
+	defer os.Unsetenv("WATCHDOG_PID")
+
+	os.Setenv("WATCHDOG_USEC", "30000000")
+	if got := systemd.WatchdogInterval(); got != time.Second*30 {
+		t.Fatalf("expected 30s, got %s", got)
+	}
+
+	os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()+1))
+	if got := systemd.WatchdogInterval(); got != 0 {
+		t.Fatalf("expected no watchdog for another process, got %s", got)
+	}
+}
@@ -0,0 +1,441 @@
+// Package xinput is a minimal XInput2 client reporting raw key and button events along with their source device.
+//
+// xgb has no XInput bindings and can not read generic events, which XInput2 events are,
+// so this package talks to the X server over its own connection.
+package xinput
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// raw event types, as XInput2 numbers them
+const (
+	RawKeyPress      = 13
+	RawKeyRelease    = 14
+	RawButtonPress   = 15
+	RawButtonRelease = 16
+
+	hierarchyChanged = 11
+	genericEvent     = 35
+	allDevices       = 0
+	allMasterDevices = 1
+
+	opQueryExtension  = 98
+	opXISelectEvents  = 46
+	opXIQueryVersion  = 47
+	opXIQueryDevice   = 48
+	extensionName     = "XInputExtension"
+	authorisationName = "MIT-MAGIC-COOKIE-1"
+)
+
+// Event is a raw key or button event
+type Event struct {
+	// Type is one of RawKeyPress, RawKeyRelease, RawButtonPress and RawButtonRelease
+	Type int
+	// Detail is the keycode or the button number
+	Detail uint32
+	// Device is the name of the device which generated the event
+	Device   string
+	SourceID uint16
+	Time     uint32
+}
+
+// Conn is a connection to an X server listening to raw input events
+type Conn struct {
+	conn    net.Conn
+	opcode  byte
+	root    uint32
+	events  chan Event
+	devices map[uint16]string
+	mu      sync.Mutex
+	closed  bool
+}
+
+// Dial connects to given display, an empty display means $DISPLAY, and starts listening to raw input events
+func Dial(display string) (c *Conn, err error) {
+	if display == "" {
+		display = os.Getenv("DISPLAY")
+	}
+
+	conn, number, err := dial(display)
+	if err != nil {
+		return
+	}
+
+	c = &Conn{
+		conn:    conn,
+		events:  make(chan Event),
+		devices: make(map[uint16]string),
+	}
+
+	defer func() {
+		if err != nil {
+			_ = conn.Close()
+			c = nil
+		}
+	}()
+
+	if err = c.setup(number); err != nil {
+		return
+	}
+	if err = c.init(); err != nil {
+		return
+	}
+
+	go c.read()
+
+	return
+}
+
+// Events returns the stream of raw input events, it's closed once the connection closes
+func (c *Conn) Events() <-chan Event {
+	return c.events
+}
+
+// Devices returns the names of the input devices by their ids
+func (c *Conn) Devices() map[uint16]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	devices := make(map[uint16]string, len(c.devices))
+	for id, name := range c.devices {
+		devices[id] = name
+	}
+	return devices
+}
+
+// Close closes the connection
+func (c *Conn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		_ = c.conn.Close()
+	}
+}
+
+// dial opens a socket to the X server of a display like :0, :0.0, unix:0 or host:0
+func dial(display string) (conn net.Conn, number string, err error) {
+	colon := strings.LastIndex(display, ":")
+	if colon < 0 {
+		err = fmt.Errorf("%q is not a valid display", display)
+		return
+	}
+
+	host := display[:colon]
+	number = display[colon+1:]
+	if dot := strings.Index(number, "."); dot >= 0 {
+		number = number[:dot]
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		err = fmt.Errorf("%q is not a valid display", display)
+		return
+	}
+
+	if host == "" || host == "unix" {
+		conn, err = net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	} else {
+		conn, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)))
+	}
+	return
+}
+
+// authority returns the MIT-MAGIC-COOKIE-1 cookie of a local display from the Xauthority file, if any
+func authority(number string) []byte {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = home + "/.Xauthority"
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	hostname, _ := os.Hostname()
+
+	readString := func() (string, error) {
+		var length uint16
+		if err := binary.Read(f, binary.BigEndian, &length); err != nil {
+			return "", err
+		}
+		buf := make([]byte, length)
+		_, err := io.ReadFull(f, buf)
+		return string(buf), err
+	}
+
+	const (
+		familyLocal = 256
+		familyWild  = 65535
+	)
+
+	for {
+		var family uint16
+		if binary.Read(f, binary.BigEndian, &family) != nil {
+			return nil
+		}
+		var fields [4]string
+		for i := range fields {
+			if fields[i], err = readString(); err != nil {
+				return nil
+			}
+		}
+		address, num, name, data := fields[0], fields[1], fields[2], fields[3]
+
+		if (family == familyWild || (family == familyLocal && address == hostname)) &&
+			(num == "" || num == number) && name == authorisationName {
+			return []byte(data)
+		}
+	}
+}
+
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
+
+// setup performs the connection setup
+func (c *Conn) setup(number string) error {
+	cookie := authority(number)
+	name := authorisationName
+	if cookie == nil {
+		name = ""
+	}
+
+	req := make([]byte, 12, 12+len(name)+pad(len(name))+len(cookie)+pad(len(cookie)))
+	req[0] = 'l'
+	binary.LittleEndian.PutUint16(req[2:], 11)
+	binary.LittleEndian.PutUint16(req[6:], uint16(len(name)))
+	binary.LittleEndian.PutUint16(req[8:], uint16(len(cookie)))
+	req = append(req, name...)
+	req = append(req, make([]byte, pad(len(name)))...)
+	req = append(req, cookie...)
+	req = append(req, make([]byte, pad(len(cookie)))...)
+
+	if _, err := c.conn.Write(req); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return err
+	}
+	data := make([]byte, int(binary.LittleEndian.Uint16(header[6:]))*4)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return err
+	}
+
+	if header[0] != 1 {
+		reason := string(data)
+		if header[0] == 0 && int(header[1]) <= len(data) {
+			reason = string(data[:header[1]])
+		}
+		return fmt.Errorf("the X server refused the connection (%s)", strings.TrimSpace(reason))
+	}
+
+	if len(data) < 32 {
+		return errors.New("the X server sent a malformed setup")
+	}
+	vendorLen := int(binary.LittleEndian.Uint16(data[16:]))
+	formats := int(data[21])
+	screens := 32 + vendorLen + pad(vendorLen) + 8*formats
+	if len(data) < screens+4 {
+		return errors.New("the X server sent a malformed setup")
+	}
+	c.root = binary.LittleEndian.Uint32(data[screens:])
+
+	return nil
+}
+
+// request sends a request and, if it has one, reads its reply
+func (c *Conn) request(req []byte, reply bool) ([]byte, error) {
+	binary.LittleEndian.PutUint16(req[2:], uint16(len(req)/4))
+	if _, err := c.conn.Write(req); err != nil {
+		return nil, err
+	}
+	if !reply {
+		return nil, nil
+	}
+
+	for {
+		buf, err := c.readPacket()
+		if err != nil {
+			return nil, err
+		}
+		switch buf[0] {
+		case 0:
+			return nil, fmt.Errorf("the X server replied with error %d", buf[1])
+		case 1:
+			return buf, nil
+		}
+		// events before the reply are of no interest during initialisation
+	}
+}
+
+// readPacket reads a reply, an error or an event, including the extra data of replies and generic events
+func (c *Conn) readPacket() ([]byte, error) {
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(c.conn, buf); err != nil {
+		return nil, err
+	}
+
+	if buf[0] == 1 || buf[0]&127 == genericEvent {
+		if extra := int(binary.LittleEndian.Uint32(buf[4:])) * 4; extra > 0 {
+			buf = append(buf, make([]byte, extra)...)
+			if _, err := io.ReadFull(c.conn, buf[32:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buf, nil
+}
+
+// init makes sure XInput 2 is available, reads the devices and selects raw events
+func (c *Conn) init() error {
+	name := []byte(extensionName)
+	req := make([]byte, 8, 8+len(name)+pad(len(name)))
+	req[0] = opQueryExtension
+	binary.LittleEndian.PutUint16(req[4:], uint16(len(name)))
+	req = append(req, name...)
+	req = append(req, make([]byte, pad(len(name)))...)
+
+	reply, err := c.request(req, true)
+	if err != nil {
+		return err
+	}
+	if reply[8] == 0 {
+		return errors.New("the X server does not support XInput")
+	}
+	c.opcode = reply[9]
+
+	// older servers send raw events only to the client grabbing the device, not to every one selecting them
+	req = make([]byte, 8)
+	req[0], req[1] = c.opcode, opXIQueryVersion
+	binary.LittleEndian.PutUint16(req[4:], 2)
+	binary.LittleEndian.PutUint16(req[6:], 2)
+	reply, err = c.request(req, true)
+	if err != nil {
+		return err
+	}
+	if major, minor := binary.LittleEndian.Uint16(reply[8:]), binary.LittleEndian.Uint16(reply[10:]); major < 2 || major == 2 && minor < 2 {
+		return fmt.Errorf("the X server supports XInput %d.%d, XInput 2.2 is needed", major, minor)
+	}
+
+	reply, err = c.request(c.queryDevices(), true)
+	if err != nil {
+		return err
+	}
+	c.readDevices(reply)
+
+	// raw events are selected for the master devices, they report their slave device as the source,
+	// hierarchy changes for all devices, so devices plugged in later get their names known
+	req = make([]byte, 12)
+	req[0], req[1] = c.opcode, opXISelectEvents
+	binary.LittleEndian.PutUint32(req[4:], c.root)
+	binary.LittleEndian.PutUint16(req[8:], 2)
+	req = append(req, eventMask(allMasterDevices, RawKeyPress, RawKeyRelease, RawButtonPress, RawButtonRelease)...)
+	req = append(req, eventMask(allDevices, hierarchyChanged)...)
+	_, err = c.request(req, false)
+
+	return err
+}
+
+// eventMask builds an XIEventMask of a single 4 byte mask
+func eventMask(device uint16, events ...int) []byte {
+	mask := make([]byte, 8)
+	binary.LittleEndian.PutUint16(mask, device)
+	binary.LittleEndian.PutUint16(mask[2:], 1)
+	for _, ev := range events {
+		mask[4+ev/8] |= 1 << uint(ev%8)
+	}
+	return mask
+}
+
+func (c *Conn) queryDevices() []byte {
+	req := make([]byte, 8)
+	req[0], req[1] = c.opcode, opXIQueryDevice
+	binary.LittleEndian.PutUint16(req[4:], allDevices)
+	return req
+}
+
+// readDevices reads the device names out of a XIQueryDevice reply
+func (c *Conn) readDevices(reply []byte) {
+	devices := make(map[uint16]string)
+
+	count := int(binary.LittleEndian.Uint16(reply[8:]))
+	offset := 32
+	for i := 0; i < count && offset+12 <= len(reply); i++ {
+		id := binary.LittleEndian.Uint16(reply[offset:])
+		classes := int(binary.LittleEndian.Uint16(reply[offset+6:]))
+		nameLen := int(binary.LittleEndian.Uint16(reply[offset+8:]))
+		offset += 12
+		if offset+nameLen > len(reply) {
+			break
+		}
+		devices[id] = string(reply[offset : offset+nameLen])
+		offset += nameLen + pad(nameLen)
+
+		// skip the device classes, their length is in 4 byte units
+		for j := 0; j < classes && offset+4 <= len(reply); j++ {
+			offset += int(binary.LittleEndian.Uint16(reply[offset+2:])) * 4
+		}
+	}
+
+	c.mu.Lock()
+	c.devices = devices
+	c.mu.Unlock()
+}
+
+// read reads raw events until the connection is closed
+func (c *Conn) read() {
+	defer close(c.events)
+
+	for {
+		buf, err := c.readPacket()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case buf[0] == 1:
+			// the only request sent whilst reading is XIQueryDevice
+			c.readDevices(buf)
+		case buf[0]&127 == genericEvent && buf[1] == c.opcode:
+			evType := int(binary.LittleEndian.Uint16(buf[8:]))
+			switch evType {
+			case hierarchyChanged:
+				if _, err = c.request(c.queryDevices(), false); err != nil {
+					return
+				}
+			case RawKeyPress, RawKeyRelease, RawButtonPress, RawButtonRelease:
+				source := binary.LittleEndian.Uint16(buf[20:])
+				c.mu.Lock()
+				device := c.devices[source]
+				c.mu.Unlock()
+
+				c.events <- Event{
+					Type:     evType,
+					Detail:   binary.LittleEndian.Uint32(buf[16:]),
+					Device:   device,
+					SourceID: source,
+					Time:     binary.LittleEndian.Uint32(buf[12:]),
+				}
+			}
+		}
+	}
+}